@@ -22,6 +22,10 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -39,7 +43,18 @@ type Client struct {
 	UserAgent string
 	APIKey    string
 
-	client *http.Client
+	client       *http.Client
+	geo          GeoLocator
+	plugins      []Plugin
+	destinations []Destination
+	insertId     InsertIdFunc
+	dedupe       *DedupeCache
+	plan         *TrackingPlan
+	planMode     PlanMode
+	logger       Logger
+	metrics      Metrics
+	tracer       trace.Tracer
+	onError      func(ctx context.Context, err error)
 
 	// common service is shared between all exposed services
 	common service
@@ -60,6 +75,10 @@ func New(apiKey string) *Client {
 		BaseURL:   baseURL,
 		UserAgent: defaultUserAgent,
 		APIKey:    apiKey,
+		insertId:  RandomInsertId,
+		logger:    NopLogger,
+		metrics:   NopMetrics,
+		tracer:    otel.Tracer(tracerName),
 	}
 
 	c.common.client = &c
@@ -140,14 +159,28 @@ func (c *Client) NewRequest(ctx context.Context, method, endpoint string, body R
 	return req, nil
 }
 
-// Do a http request to Amplitude and handles the response it receives
+// Do a http request to Amplitude and handles the response it receives, recording it in a client span
 func (c *Client) Do(req *http.Request, v interface{}) (*http.Response, error) {
 	if req == nil {
 		return nil, errors.New("no request passed")
 	}
 
+	req, span := c.startSpan(req)
+	resp, err := c.do(req, v)
+	endSpan(span, resp, v, err)
+
+	return resp, err
+}
+
+// do sends the request and decodes the response into v
+func (c *Client) do(req *http.Request, v interface{}) (*http.Response, error) {
+	c.traceRequest(req)
+	start := time.Now()
 	resp, err := c.client.Do(req)
 	if err != nil {
+		c.metrics.Request(endpoint(req), 0, time.Since(start))
+		c.traceFailure(req, err)
+
 		if ctx := req.Context(); ctx != nil && ctx.Err() != nil {
 			return nil, ctx.Err()
 		}
@@ -155,6 +188,9 @@ func (c *Client) Do(req *http.Request, v interface{}) (*http.Response, error) {
 		return nil, err
 	}
 
+	c.metrics.Request(endpoint(req), resp.StatusCode, time.Since(start))
+	c.traceResponse(req, resp, start)
+
 	// if the response is an API error that we know about, this propagates it up the stack,
 	// if its one we don't know about check the error context for additional information
 	if err := AsError(resp); err != nil {
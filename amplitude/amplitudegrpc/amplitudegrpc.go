@@ -0,0 +1,123 @@
+// Package amplitudegrpc sends amplitude events for grpc calls, user and device ids are read
+// from the incoming metadata keys matching the headers configured on the middleware.
+package amplitudegrpc
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/pghq/go-amplitude/amplitude"
+)
+
+// UnaryServerInterceptor creates a grpc interceptor sending events for unary calls through the middleware
+func UnaryServerInterceptor(m *amplitude.SendMiddleware) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		id, ok := incomingIdentity(m, ctx)
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		start := time.Now()
+		resp, err := handler(amplitude.WithIdentity(ctx, id.UserId, id.DeviceId), req)
+		m.Send(newEvent(m, ctx, info.FullMethod, id, err, time.Since(start)))
+
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor creates a grpc interceptor sending events for streaming calls through the middleware
+func StreamServerInterceptor(m *amplitude.SendMiddleware) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := ss.Context()
+		id, ok := incomingIdentity(m, ctx)
+		if !ok {
+			return handler(srv, ss)
+		}
+
+		start := time.Now()
+		err := handler(srv, &identityStream{
+			ServerStream: ss,
+			ctx:          amplitude.WithIdentity(ctx, id.UserId, id.DeviceId),
+		})
+
+		event := newEvent(m, ctx, info.FullMethod, id, err, time.Since(start))
+		event.Properties["client_stream"] = info.IsClientStream
+		event.Properties["server_stream"] = info.IsServerStream
+		m.Send(event)
+
+		return err
+	}
+}
+
+// incomingIdentity reads the user and device ids from the incoming metadata
+func incomingIdentity(m *amplitude.SendMiddleware, ctx context.Context) (amplitude.Identity, bool) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	get := func(key string) string {
+		if key == "" {
+			return ""
+		}
+
+		if values := md.Get(strings.ToLower(key)); len(values) > 0 {
+			return values[0]
+		}
+
+		return ""
+	}
+
+	userHeader, deviceHeader := m.IdentityHeaders()
+	id := amplitude.Identity{UserId: get(userHeader), DeviceId: get(deviceHeader)}
+	return id, id.UserId != "" || id.DeviceId != ""
+}
+
+// newEvent creates a new amplitude event from a grpc call
+func newEvent(m *amplitude.SendMiddleware, ctx context.Context, method string, id amplitude.Identity, err error, latency time.Duration) *amplitude.Event {
+	code := status.Code(err)
+	event := amplitude.Event{
+		UserId:     id.UserId,
+		DeviceId:   id.DeviceId,
+		Name:       method,
+		Time:       time.Now().UnixMilli(),
+		Properties: map[string]interface{}{"grpc_code": code.String()},
+	}
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		if ip := peerIP(p.Addr.String()); ip != nil {
+			event.IP = ip.String()
+		}
+	}
+
+	if code != codes.OK {
+		event.Properties["error"] = status.Convert(err).Message()
+	}
+
+	// the grpc code is not an http status so it is only recorded as grpc_code
+	return m.Enrich(event.Latency(latency.Milliseconds()).Trace(ctx))
+}
+
+// peerIP parses the ip of a peer address
+func peerIP(addr string) net.IP {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+
+	return net.ParseIP(strings.Trim(addr, "[]"))
+}
+
+// identityStream overrides the context of a server stream
+type identityStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context gets the stream context with the tracked identity
+func (s *identityStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,104 @@
+package amplitudegrpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/pghq/go-amplitude/amplitude"
+)
+
+func TestInterceptors(t *testing.T) {
+	m := amplitude.New("").SendMiddleware().UserHeader("User-Id").DeviceHeader("Device-Id").Environment("test").AnonymizeIP(true)
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor(m)),
+		grpc.StreamInterceptor(StreamServerInterceptor(m)),
+	)
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("tests", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+	go func() { _ = server.Serve(listener) }()
+	defer server.Stop()
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithInsecure(),
+	)
+	assert.Nil(t, err)
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+
+	t.Run("ignores calls without identity", func(t *testing.T) {
+		_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "tests"})
+		assert.Nil(t, err)
+		assert.Nil(t, m.Event())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		stream, _ := client.Watch(ctx, &healthpb.HealthCheckRequest{Service: "tests"})
+		_, err = stream.Recv()
+		assert.Nil(t, err)
+		assert.Nil(t, m.Event())
+	})
+
+	t.Run("sends events for unary calls", func(t *testing.T) {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "user-id", "user", "device-id", "device")
+		_, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: "tests"})
+		assert.Nil(t, err)
+
+		event := m.Event()
+		assert.Equal(t, "/grpc.health.v1.Health/Check", event.Name)
+		assert.Equal(t, "user", event.UserId)
+		assert.Equal(t, "device", event.DeviceId)
+		assert.Equal(t, "OK", event.Properties["grpc_code"])
+		assert.NotContains(t, event.Properties, "status")
+		assert.Equal(t, "test", event.Properties["environment"])
+		assert.Contains(t, event.Properties, "latency")
+
+		_, err = client.Check(ctx, &healthpb.HealthCheckRequest{Service: "missing"})
+		assert.NotNil(t, err)
+
+		event = m.Event()
+		assert.Equal(t, "NotFound", event.Properties["grpc_code"])
+		assert.NotContains(t, event.Properties, "status")
+		assert.Equal(t, "unknown service", event.Properties["error"])
+	})
+
+	t.Run("sends events for streaming calls", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(metadata.AppendToOutgoingContext(context.Background(), "user-id", "user"))
+		stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{Service: "tests"})
+		assert.Nil(t, err)
+		_, err = stream.Recv()
+		assert.Nil(t, err)
+		cancel()
+
+		var event *amplitude.Event
+		assert.Eventually(t, func() bool {
+			event = m.Event()
+			return event != nil
+		}, time.Second, time.Millisecond)
+		assert.Equal(t, "/grpc.health.v1.Health/Watch", event.Name)
+		assert.Equal(t, "user", event.UserId)
+		assert.Equal(t, "Canceled", event.Properties["grpc_code"])
+		assert.Equal(t, false, event.Properties["client_stream"])
+		assert.Equal(t, true, event.Properties["server_stream"])
+	})
+}
+
+func TestPeerIP(t *testing.T) {
+	assert.Equal(t, "127.0.0.1", peerIP("127.0.0.1:8080").String())
+	assert.Equal(t, "::1", peerIP("[::1]:8080").String())
+	assert.Nil(t, peerIP("bufconn"))
+}
@@ -0,0 +1,112 @@
+// Package amplitudeprom exports the metrics of the amplitude delivery pipeline to Prometheus.
+package amplitudeprom
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/pghq/go-amplitude/amplitude"
+)
+
+// Metrics is a Prometheus collector of the amplitude delivery pipeline
+type Metrics struct {
+	enqueued  prometheus.Counter
+	dropped   *prometheus.CounterVec
+	flushed   prometheus.Counter
+	buffered  prometheus.Gauge
+	batches   prometheus.Histogram
+	latency   *prometheus.HistogramVec
+	responses *prometheus.CounterVec
+}
+
+var _ amplitude.Metrics = (*Metrics)(nil)
+
+// New creates a collector with the metric names prefixed by the namespace (e.g. "myapp"),
+// it must be registered (e.g. prometheus.MustRegister) to be exported
+func New(namespace string) *Metrics {
+	opts := func(name, help string) prometheus.Opts {
+		return prometheus.Opts{Namespace: namespace, Subsystem: "amplitude", Name: name, Help: help}
+	}
+
+	m := Metrics{
+		enqueued: prometheus.NewCounter(prometheus.CounterOpts(opts("events_enqueued_total",
+			"Number of events added to the buffer."))),
+		dropped: prometheus.NewCounterVec(prometheus.CounterOpts(opts("events_dropped_total",
+			"Number of events dropped by reason.")), []string{"reason"}),
+		flushed: prometheus.NewCounter(prometheus.CounterOpts(opts("events_flushed_total",
+			"Number of events uploaded."))),
+		buffered: prometheus.NewGauge(prometheus.GaugeOpts(opts("events_buffered",
+			"Number of events waiting in the buffer."))),
+		batches: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "amplitude",
+			Name:      "batch_size",
+			Help:      "Number of events per upload.",
+			Buckets:   prometheus.ExponentialBuckets(1, 4, 7),
+		}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "amplitude",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of the requests to Amplitude by endpoint.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"endpoint"}),
+		responses: prometheus.NewCounterVec(prometheus.CounterOpts(opts("responses_total",
+			"Number of responses from Amplitude by endpoint and status code, 0 if none was received.")),
+			[]string{"endpoint", "code"}),
+	}
+
+	return &m
+}
+
+// Describe implements the prometheus.Collector interface
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range m.collectors() {
+		c.Describe(ch)
+	}
+}
+
+// Collect implements the prometheus.Collector interface
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range m.collectors() {
+		c.Collect(ch)
+	}
+}
+
+// Enqueued implements the amplitude.Metrics interface
+func (m *Metrics) Enqueued(n int) {
+	m.enqueued.Add(float64(n))
+}
+
+// Dropped implements the amplitude.Metrics interface
+func (m *Metrics) Dropped(reason amplitude.DropReason, n int) {
+	m.dropped.WithLabelValues(string(reason)).Add(float64(n))
+}
+
+// Flushed implements the amplitude.Metrics interface
+func (m *Metrics) Flushed(n int) {
+	m.flushed.Add(float64(n))
+}
+
+// Buffered implements the amplitude.Metrics interface
+func (m *Metrics) Buffered(n int) {
+	m.buffered.Set(float64(n))
+}
+
+// Batch implements the amplitude.Metrics interface
+func (m *Metrics) Batch(size int) {
+	m.batches.Observe(float64(size))
+}
+
+// Request implements the amplitude.Metrics interface
+func (m *Metrics) Request(endpoint string, code int, latency time.Duration) {
+	m.latency.WithLabelValues(endpoint).Observe(latency.Seconds())
+	m.responses.WithLabelValues(endpoint, strconv.Itoa(code)).Inc()
+}
+
+// collectors lists the metrics of the collector
+func (m *Metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.enqueued, m.dropped, m.flushed, m.buffered, m.batches, m.latency, m.responses}
+}
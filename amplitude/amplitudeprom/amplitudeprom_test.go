@@ -0,0 +1,57 @@
+package amplitudeprom
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pghq/go-amplitude/amplitude"
+	"github.com/pghq/go-amplitude/amplitude/amplitudetest"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Run("registers", func(t *testing.T) {
+		reg := prometheus.NewRegistry()
+		assert.Nil(t, reg.Register(New("test")))
+		assert.NotNil(t, reg.Register(New("test")))
+	})
+
+	t.Run("measures the delivery pipeline", func(t *testing.T) {
+		s := amplitudetest.NewServer(t)
+		metrics := New("test")
+		m := s.Client("test-key").WithMetrics(metrics).SendMiddleware()
+
+		m.Send(&amplitude.Event{Name: "a", UserId: "test-user"})
+		m.Send(&amplitude.Event{Name: "b", UserId: "test-user"})
+		m.Send(&amplitude.Event{Name: "invalid"})
+		assert.Equal(t, 3.0, testutil.ToFloat64(metrics.enqueued))
+		assert.Equal(t, 3.0, testutil.ToFloat64(metrics.buffered))
+
+		m.Flush(context.TODO())
+		assert.Equal(t, 2.0, testutil.ToFloat64(metrics.flushed))
+		assert.Equal(t, 0.0, testutil.ToFloat64(metrics.buffered))
+		assert.Equal(t, 1.0, testutil.ToFloat64(metrics.dropped.WithLabelValues("invalid")))
+		assert.Equal(t, 1.0, testutil.ToFloat64(metrics.responses.WithLabelValues("/batch", "200")))
+
+		expected := `
+			# HELP test_amplitude_batch_size Number of events per upload.
+			# TYPE test_amplitude_batch_size histogram
+			test_amplitude_batch_size_bucket{le="1"} 0
+			test_amplitude_batch_size_bucket{le="4"} 1
+			test_amplitude_batch_size_bucket{le="16"} 1
+			test_amplitude_batch_size_bucket{le="64"} 1
+			test_amplitude_batch_size_bucket{le="256"} 1
+			test_amplitude_batch_size_bucket{le="1024"} 1
+			test_amplitude_batch_size_bucket{le="4096"} 1
+			test_amplitude_batch_size_bucket{le="+Inf"} 1
+			test_amplitude_batch_size_sum 2
+			test_amplitude_batch_size_count 1
+		`
+		assert.Nil(t, testutil.CollectAndCompare(metrics, strings.NewReader(expected), "test_amplitude_batch_size"))
+		assert.Equal(t, 1, testutil.CollectAndCount(metrics, "test_amplitude_request_duration_seconds"))
+	})
+}
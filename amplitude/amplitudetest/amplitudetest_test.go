@@ -0,0 +1,394 @@
+package amplitudetest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pghq/go-amplitude/amplitude"
+)
+
+// post sends a JSON body to the emulator and decodes the response
+func post(e *Emulator, endpoint string, body interface{}) (int, map[string]interface{}) {
+	data, _ := json.Marshal(body)
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodPost, endpoint, bytes.NewReader(data)))
+
+	var res map[string]interface{}
+	_ = json.NewDecoder(w.Body).Decode(&res)
+	return w.Code, res
+}
+
+// postForm sends an identification form to the emulator
+func postForm(e *Emulator, endpoint string, values url.Values) (int, string) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, endpoint, strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	e.ServeHTTP(w, r)
+	return w.Code, strings.TrimSpace(w.Body.String())
+}
+
+func TestServer(t *testing.T) {
+	t.Run("receives events sent by the client", func(t *testing.T) {
+		s := NewServer(t)
+		client := s.Client("test-key")
+
+		event := &amplitude.Event{
+			Name:           "Song Played",
+			UserId:         "test-user",
+			Properties:     map[string]interface{}{"duration": 180},
+			UserProperties: map[string]interface{}{"plan": "premium"},
+		}
+
+		resp, err := client.Events.Send(context.TODO(), event, &amplitude.Event{Name: "Signed Up", DeviceId: "test-device"})
+		assert.Nil(t, err)
+		assert.Equal(t, 200, resp.Code)
+		assert.Equal(t, 2, resp.EventsIngested)
+		assert.Greater(t, resp.PayloadSize, 0)
+
+		got := s.ExpectEvent("Song Played", All(User("test-user"), Property("duration", 180), UserProperty("plan", "premium")))
+		assert.Equal(t, event.InsertId, got.InsertId)
+		s.ExpectEvent("Signed Up", Device("test-device"))
+		s.ExpectNoEvent("Song Played", Property("duration", 200))
+		assert.Len(t, s.Find("Song Played", nil), 1)
+
+		s.Reset()
+		assert.Empty(t, s.Events())
+	})
+
+	t.Run("fails expectations", func(t *testing.T) {
+		s := NewServer(t)
+		_, err := s.Client("test-key").Events.Send(context.TODO(), &amplitude.Event{Name: "Signed Up", UserId: "test-user"})
+		assert.Nil(t, err)
+
+		mt := &testing.T{}
+		s.t = mt
+		assert.Nil(t, s.ExpectEvent("Song Played", nil))
+		assert.True(t, mt.Failed())
+		assert.Equal(t, "[Signed Up]", s.received())
+
+		mt = &testing.T{}
+		s.t = mt
+		s.ExpectNoEvent("Signed Up", User("test-user"))
+		assert.True(t, mt.Failed())
+
+		s.Close()
+		s.Reset()
+		assert.Equal(t, "no events", s.received())
+	})
+
+	t.Run("reports client errors", func(t *testing.T) {
+		s := NewServer(t)
+		s.APIKey("test-key")
+
+		_, err := s.Client("wrong-key").Events.Send(context.TODO(), &amplitude.Event{Name: "Signed Up", UserId: "test-user"})
+		assert.EqualError(t, err, "error code 400 recieved with message Invalid API key: wrong-key")
+		assert.Empty(t, s.Events())
+	})
+}
+
+func TestEmulator(t *testing.T) {
+	valid := func(userId string) map[string]interface{} {
+		return map[string]interface{}{"event_type": "Signed Up", "user_id": userId}
+	}
+
+	t.Run("serves the upload endpoints", func(t *testing.T) {
+		e := NewEmulator()
+		for _, endpoint := range []string{"/batch", "/2/httpapi"} {
+			code, res := post(e, endpoint, map[string]interface{}{
+				"api_key": "test-key",
+				"events":  []interface{}{valid("test-user")},
+			})
+			assert.Equal(t, 200, code)
+			assert.Equal(t, 1.0, res["events_ingested"])
+		}
+
+		assert.Len(t, e.Events(), 2)
+
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/batch", nil))
+		assert.Equal(t, 405, w.Code)
+
+		w = httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/unknown", nil))
+		assert.Equal(t, 404, w.Code)
+	})
+
+	t.Run("rejects bad requests", func(t *testing.T) {
+		e := NewEmulator()
+
+		code, res := post(e, "/batch", "not an object")
+		assert.Equal(t, 400, code)
+		assert.Equal(t, "Invalid JSON request body", res["error"])
+
+		code, res = post(e, "/batch", map[string]interface{}{"events": []interface{}{valid("test-user")}})
+		assert.Equal(t, 400, code)
+		assert.Equal(t, "api_key", res["missing_field"])
+
+		code, res = post(e, "/batch", map[string]interface{}{"api_key": "test-key"})
+		assert.Equal(t, 400, code)
+		assert.Equal(t, "events", res["missing_field"])
+
+		code, res = post(e, "/batch", map[string]interface{}{
+			"api_key": "test-key",
+			"events": []interface{}{
+				valid("test-user"),
+				map[string]interface{}{"user_id": "test-user"},
+				map[string]interface{}{"event_type": "Signed Up"},
+				map[string]interface{}{"event_type": "Signed Up", "device_id": "null", "time": 1600000},
+				nil,
+			},
+		})
+		assert.Equal(t, 400, code)
+		assert.Equal(t, "Request missing required field", res["error"])
+		assert.Equal(t, map[string]interface{}{"event_type": []interface{}{1.0, 4.0}, "user_id": []interface{}{2.0}}, res["events_with_missing_fields"])
+		assert.Equal(t, map[string]interface{}{"device_id": []interface{}{3.0}, "time": []interface{}{3.0}}, res["events_with_invalid_fields"])
+
+		code, res = post(e, "/batch", map[string]interface{}{
+			"api_key": "test-key",
+			"events":  []interface{}{valid("user")},
+		})
+		assert.Equal(t, 400, code)
+		assert.Equal(t, "Invalid field values on some events", res["error"])
+		assert.Empty(t, e.Events())
+	})
+
+	t.Run("rejects large requests", func(t *testing.T) {
+		e := NewEmulator().EventLimit(1)
+		code, res := post(e, "/2/httpapi", map[string]interface{}{
+			"api_key": "test-key",
+			"events":  []interface{}{valid("test-user"), valid("test-user")},
+		})
+		assert.Equal(t, 413, code)
+		assert.Equal(t, "Too many events in request", res["error"])
+
+		e.PayloadLimit(16)
+		code, res = post(e, "/batch", map[string]interface{}{
+			"api_key": "test-key",
+			"events":  []interface{}{valid("test-user")},
+		})
+		assert.Equal(t, 413, code)
+		assert.Equal(t, "Payload too large", res["error"])
+
+		code, _ = postForm(e, "/identify", url.Values{"api_key": {"test-key"}, "identification": {`{"user_id":"test-user"}`}})
+		assert.Equal(t, 413, code)
+	})
+
+	t.Run("throttles users and devices", func(t *testing.T) {
+		now := time.Now()
+		e := NewEmulator().EventsPerSecond(2)
+		e.now = func() time.Time { return now }
+
+		upload := func(events ...interface{}) (int, map[string]interface{}) {
+			return post(e, "/batch", map[string]interface{}{"api_key": "test-key", "events": events})
+		}
+
+		code, _ := upload(valid("test-user"), valid("test-user"))
+		assert.Equal(t, 200, code)
+
+		device := map[string]interface{}{"event_type": "Signed Up", "device_id": "test-device"}
+		code, res := upload(valid("other-user"), valid("test-user"), device, device, device)
+		assert.Equal(t, 429, code)
+		assert.Equal(t, 2.0, res["eps_threshold"])
+		assert.Equal(t, map[string]interface{}{"test-user": 3.0}, res["throttled_users"])
+		assert.Equal(t, map[string]interface{}{"test-device": 3.0}, res["throttled_devices"])
+		assert.Equal(t, []interface{}{1.0, 2.0, 3.0, 4.0}, res["throttled_events"])
+
+		code, _ = upload(valid("other-user"))
+		assert.Equal(t, 200, code)
+
+		now = now.Add(time.Second)
+		code, _ = upload(valid("test-user"), valid("test-user"))
+		assert.Equal(t, 200, code)
+		assert.Len(t, e.Events(), 5)
+
+		e.EventsPerSecond(0)
+		code, _ = upload(valid("test-user"), valid("test-user"), valid("test-user"))
+		assert.Equal(t, 200, code)
+	})
+
+	t.Run("serves the identify endpoints", func(t *testing.T) {
+		e := NewEmulator().APIKey("test-key")
+
+		code, body := postForm(e, "/identify", url.Values{
+			"api_key":        {"test-key"},
+			"identification": {`{"user_id":"test-user","user_properties":{"plan":"premium"}}`},
+		})
+		assert.Equal(t, 200, code)
+		assert.Equal(t, "success", body)
+
+		code, _ = postForm(e, "/identify", url.Values{
+			"api_key":        {"test-key"},
+			"identification": {`[{"device_id":"test-device"},{"user_id":"other-user"}]`},
+		})
+		assert.Equal(t, 200, code)
+		assert.Len(t, e.Identifications(), 3)
+		assert.Equal(t, "premium", e.Identifications()[0].UserProperties["plan"])
+
+		code, _ = postForm(e, "/groupidentify", url.Values{
+			"api_key":        {"test-key"},
+			"identification": {`{"group_type":"org","group_value":"pghq","group_properties":{"seats":10}}`},
+		})
+		assert.Equal(t, 200, code)
+		assert.Equal(t, []*GroupIdentification{{GroupType: "org", GroupValue: "pghq", GroupProperties: map[string]interface{}{"seats": 10.0}}}, e.GroupIdentifications())
+
+		bad := []struct {
+			endpoint string
+			values   url.Values
+			message  string
+		}{
+			{"/identify", url.Values{"identification": {`{"user_id":"test-user"}`}}, "Request missing required field"},
+			{"/identify", url.Values{"api_key": {"wrong-key"}, "identification": {`{"user_id":"test-user"}`}}, "Invalid API key: wrong-key"},
+			{"/identify", url.Values{"api_key": {"test-key"}}, "missing identification"},
+			{"/identify", url.Values{"api_key": {"test-key"}, "identification": {`{`}}, "invalid identification"},
+			{"/identify", url.Values{"api_key": {"test-key"}, "identification": {`{"user_properties":{}}`}}, "missing user_id or device_id"},
+			{"/groupidentify", url.Values{"api_key": {"test-key"}, "identification": {`{"group_type":"org"}`}}, "missing group_type or group_value"},
+		}
+
+		for _, b := range bad {
+			code, body := postForm(e, b.endpoint, b.values)
+			assert.Equal(t, 400, code)
+			assert.Equal(t, b.message, body)
+		}
+
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/identify", strings.NewReader("%")))
+		assert.Equal(t, 400, w.Code)
+		assert.Len(t, e.Identifications(), 3)
+		assert.Len(t, e.GroupIdentifications(), 1)
+	})
+}
+
+func TestEmulator_Scenario(t *testing.T) {
+	t.Run("decides faults", func(t *testing.T) {
+		reset, unavailable := Fault{Reset: true}, Fault{Status: 503}
+
+		script := Script(reset, Fault{})
+		assert.Equal(t, &reset, script(0))
+		assert.Equal(t, &Fault{}, script(1))
+		assert.Nil(t, script(2))
+
+		every := Every(3, unavailable)
+		assert.Nil(t, every(0))
+		assert.Equal(t, &unavailable, every(2))
+		assert.Equal(t, &unavailable, every(5))
+		assert.Nil(t, Every(0, unavailable)(0))
+
+		window := Window(1, 3, reset)
+		assert.Nil(t, window(0))
+		assert.Equal(t, &reset, window(1))
+		assert.Equal(t, &reset, window(2))
+		assert.Nil(t, window(3))
+
+		combined := Scenarios(window, every)
+		assert.Equal(t, &reset, combined(2))
+		assert.Equal(t, &unavailable, combined(5))
+		assert.Nil(t, combined(0))
+	})
+
+	t.Run("reports delivery of accepted events", func(t *testing.T) {
+		s := NewServer(t)
+		s.Scenario(Script(
+			Fault{Reset: true, Ingest: true},
+			Fault{Status: 503},
+			Fault{Throttle: true},
+			Fault{Reject: Property("n", 2)},
+		))
+
+		var events []*amplitude.Event
+		for n := 1; n <= 3; n++ {
+			events = append(events, &amplitude.Event{
+				Name:       "Song Played",
+				UserId:     "test-user",
+				Properties: map[string]interface{}{"n": n},
+			})
+		}
+
+		// retry the whole batch until it is accepted, as a naive caller would
+		m := s.Client("test-key").SendMiddleware()
+		var errs []error
+		for attempt := 0; attempt < 4; attempt++ {
+			for _, event := range events {
+				m.Send(event)
+			}
+
+			m.Flush(context.TODO())
+			if err := m.Error(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		assert.Len(t, errs, 4)
+		assert.Contains(t, errs[1].Error(), "Service Unavailable")
+		assert.Contains(t, errs[2].Error(), "Too many requests")
+		assert.Contains(t, errs[3].Error(), "Invalid field values on some events")
+
+		never := &amplitude.Event{Name: "Song Played", UserId: "test-user"}
+		_, err := s.Client("test-key").Events.Send(context.TODO(), &amplitude.Event{Name: "Signed Up", UserId: "test-user"})
+		assert.Nil(t, err)
+
+		report := s.Report(append(events, never)...)
+		assert.Equal(t, []*amplitude.Event{events[1]}, report.Delivered)
+		assert.Equal(t, []*amplitude.Event{events[0], events[2]}, report.Duplicated)
+		assert.Equal(t, []*amplitude.Event{never}, report.Lost)
+		assert.Len(t, report.Unexpected, 1)
+		assert.Equal(t, "Signed Up", report.Unexpected[0].Name)
+		assert.Equal(t, 2, report.Received[events[0].InsertId])
+		assert.False(t, report.OK())
+		assert.Equal(t, "1 delivered, 2 duplicated, 1 lost, 1 unexpected", report.String())
+
+		mt := &testing.T{}
+		s.t = mt
+		s.ExpectDelivered(events...)
+		assert.True(t, mt.Failed())
+	})
+
+	t.Run("delivers when faults are retried safely", func(t *testing.T) {
+		s := NewServer(t)
+		s.Scenario(Every(2, Fault{Status: 502}))
+
+		client := s.Client("test-key")
+		event := &amplitude.Event{Name: "Signed Up", UserId: "test-user"}
+		_, err := client.Events.Send(context.TODO(), event)
+		assert.Nil(t, err)
+
+		_, err = client.Events.Send(context.TODO(), newEvent("other-user"))
+		assert.NotNil(t, err)
+
+		assert.True(t, s.ExpectDelivered(event).OK())
+	})
+
+	t.Run("delays uploads", func(t *testing.T) {
+		s := NewServer(t)
+		s.Scenario(Script(Fault{Latency: 200 * time.Millisecond}, Fault{Latency: time.Millisecond}))
+
+		client := s.Client("test-key").WithHttpClient(&http.Client{Timeout: 50 * time.Millisecond})
+		_, err := client.Events.Send(context.TODO(), newEvent("test-user"))
+		assert.NotNil(t, err)
+		assert.Empty(t, s.Events())
+
+		_, err = client.Events.Send(context.TODO(), newEvent("test-user"))
+		assert.Nil(t, err)
+		assert.Len(t, s.Events(), 1)
+
+		s.Reset()
+		s.Scenario(Script(Fault{Reset: true}))
+		w := httptest.NewRecorder()
+		assert.Panics(t, func() {
+			s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader("{}")))
+		})
+	})
+}
+
+// newEvent returns a valid event of the user
+func newEvent(userId string) *amplitude.Event {
+	return &amplitude.Event{Name: "Signed Up", UserId: userId}
+}
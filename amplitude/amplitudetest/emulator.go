@@ -0,0 +1,487 @@
+// Package amplitudetest provides an in-memory emulator of the Amplitude ingestion APIs for testing.
+package amplitudetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pghq/go-amplitude/amplitude"
+)
+
+const (
+	// DefaultEventLimit is the max number of events accepted in a single upload
+	DefaultEventLimit = 2000
+
+	// DefaultBatchPayloadLimit is the max body size of /batch requests
+	DefaultBatchPayloadLimit = 20 << 20
+
+	// DefaultHTTPPayloadLimit is the max body size of /2/httpapi, /identify and /groupidentify requests
+	DefaultHTTPPayloadLimit = 1 << 20
+
+	// DefaultEventsPerSecond is the rate of events per user or device above which uploads are throttled
+	DefaultEventsPerSecond = 1000
+)
+
+// Identification is a user property update received by the Identify API
+type Identification struct {
+	UserId         string                 `json:"user_id,omitempty"`
+	DeviceId       string                 `json:"device_id,omitempty"`
+	UserProperties map[string]interface{} `json:"user_properties,omitempty"`
+	Groups         map[string]interface{} `json:"groups,omitempty"`
+}
+
+// GroupIdentification is a group property update received by the Group Identify API
+type GroupIdentification struct {
+	GroupType       string                 `json:"group_type"`
+	GroupValue      string                 `json:"group_value"`
+	GroupProperties map[string]interface{} `json:"group_properties,omitempty"`
+}
+
+// Emulator is a http handler emulating the Amplitude ingestion APIs,
+// it validates requests the way Amplitude does and stores what it accepts in memory
+type Emulator struct {
+	apiKey          string
+	eventLimit      int
+	payloadLimit    int64
+	eventsPerSecond int
+	now             func() time.Time
+	scenario        Scenario
+
+	lock            sync.Mutex
+	events          []*amplitude.Event
+	identifications []*Identification
+	groups          []*GroupIdentification
+	windows         map[identity]*window
+	uploads         int
+}
+
+// identity is a user or device whose event rate is throttled
+type identity struct {
+	user bool
+	id   string
+}
+
+// window counts the events of a user or device in the current second
+type window struct {
+	start time.Time
+	count int
+}
+
+// response is the JSON body returned by the upload endpoints
+type response struct {
+	Code             int              `json:"code"`
+	Error            string           `json:"error,omitempty"`
+	MissingField     string           `json:"missing_field,omitempty"`
+	InvalidFields    map[string][]int `json:"events_with_invalid_fields,omitempty"`
+	MissingFields    map[string][]int `json:"events_with_missing_fields,omitempty"`
+	EPSThreshold     int              `json:"eps_threshold,omitempty"`
+	ThrottledDevices map[string]int   `json:"throttled_devices,omitempty"`
+	ThrottledUsers   map[string]int   `json:"throttled_users,omitempty"`
+	ThrottledEvents  []int            `json:"throttled_events,omitempty"`
+	EventsIngested   int              `json:"events_ingested,omitempty"`
+	PayloadSize      int              `json:"payload_size_bytes,omitempty"`
+	UploadTime       int64            `json:"server_upload_time,omitempty"`
+}
+
+// NewEmulator creates a new emulator with Amplitude's default limits
+func NewEmulator() *Emulator {
+	e := Emulator{
+		eventLimit:      DefaultEventLimit,
+		eventsPerSecond: DefaultEventsPerSecond,
+		now:             time.Now,
+		windows:         make(map[identity]*window),
+	}
+
+	return &e
+}
+
+// APIKey sets the key requests must authenticate with, any key is accepted if empty
+func (e *Emulator) APIKey(key string) *Emulator {
+	e.apiKey = key
+	return e
+}
+
+// EventLimit sets the max number of events accepted in a single upload
+func (e *Emulator) EventLimit(n int) *Emulator {
+	e.eventLimit = n
+	return e
+}
+
+// PayloadLimit sets the max body size of all endpoints, overriding their defaults
+func (e *Emulator) PayloadLimit(n int64) *Emulator {
+	e.payloadLimit = n
+	return e
+}
+
+// EventsPerSecond sets the rate of events per user or device above which uploads are throttled,
+// throttling is disabled if the rate is not positive
+func (e *Emulator) EventsPerSecond(n int) *Emulator {
+	e.eventsPerSecond = n
+	return e
+}
+
+// Events gets the events received, in order and including duplicates
+func (e *Emulator) Events() []*amplitude.Event {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return append([]*amplitude.Event(nil), e.events...)
+}
+
+// Identifications gets the user property updates received
+func (e *Emulator) Identifications() []*Identification {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return append([]*Identification(nil), e.identifications...)
+}
+
+// GroupIdentifications gets the group property updates received
+func (e *Emulator) GroupIdentifications() []*GroupIdentification {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return append([]*GroupIdentification(nil), e.groups...)
+}
+
+// Find gets the events received with the name which match the matcher
+func (e *Emulator) Find(name string, matcher Matcher) []*amplitude.Event {
+	var events []*amplitude.Event
+	for _, event := range e.Events() {
+		if event.Name == name && (matcher == nil || matcher(event)) {
+			events = append(events, event)
+		}
+	}
+
+	return events
+}
+
+// Reset forgets everything received, the current throttling windows and the uploads counted by the scenario
+func (e *Emulator) Reset() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.uploads = 0
+	e.events = nil
+	e.identifications = nil
+	e.groups = nil
+	e.windows = make(map[identity]*window)
+}
+
+// ServeHTTP implements the http.Handler interface
+func (e *Emulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/batch":
+		e.upload(w, r, DefaultBatchPayloadLimit)
+	case "/2/httpapi":
+		e.upload(w, r, DefaultHTTPPayloadLimit)
+	case "/identify":
+		e.identify(w, r)
+	case "/groupidentify":
+		e.groupIdentify(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// upload handles the Batch and HTTP V2 APIs
+func (e *Emulator) upload(w http.ResponseWriter, r *http.Request, limit int64) {
+	fault := e.fault()
+	if !fault.delay(r) {
+		return
+	}
+
+	data, ok := e.read(r, limit)
+	if !ok {
+		writeJSON(w, response{Code: http.StatusRequestEntityTooLarge, Error: "Payload too large"})
+		return
+	}
+
+	var body struct {
+		APIKey string             `json:"api_key"`
+		Events []*amplitude.Event `json:"events"`
+	}
+
+	if err := json.Unmarshal(data, &body); err != nil {
+		writeJSON(w, response{Code: http.StatusBadRequest, Error: "Invalid JSON request body"})
+		return
+	}
+
+	if !fault.ingests() && fault.fail(w, body.Events) {
+		return
+	}
+
+	if res := e.authenticate(body.APIKey); res != nil {
+		writeJSON(w, *res)
+		return
+	}
+
+	if len(body.Events) == 0 {
+		writeJSON(w, response{Code: http.StatusBadRequest, Error: "Request missing required field", MissingField: "events"})
+		return
+	}
+
+	if e.eventLimit > 0 && len(body.Events) > e.eventLimit {
+		writeJSON(w, response{Code: http.StatusRequestEntityTooLarge, Error: "Too many events in request"})
+		return
+	}
+
+	if res := validate(body.Events); res != nil {
+		writeJSON(w, *res)
+		return
+	}
+
+	events, rejected := fault.reject(body.Events)
+
+	e.lock.Lock()
+	if res := e.throttle(events); res != nil {
+		e.lock.Unlock()
+		writeJSON(w, *res)
+		return
+	}
+
+	e.events = append(e.events, events...)
+	e.lock.Unlock()
+
+	if fault.ingests() && fault.fail(w, body.Events) {
+		return
+	}
+
+	if len(rejected) > 0 {
+		writeJSON(w, response{
+			Code:          http.StatusBadRequest,
+			Error:         "Invalid field values on some events",
+			InvalidFields: map[string][]int{"event_properties": rejected},
+		})
+		return
+	}
+
+	writeJSON(w, response{
+		Code:           http.StatusOK,
+		EventsIngested: len(events),
+		PayloadSize:    len(data),
+		UploadTime:     e.now().UnixMilli(),
+	})
+}
+
+// identify handles the Identify API
+func (e *Emulator) identify(w http.ResponseWriter, r *http.Request) {
+	var identifications []*Identification
+	if !e.form(w, r, &identifications) {
+		return
+	}
+
+	for _, identification := range identifications {
+		if identification == nil || (identification.UserId == "" && identification.DeviceId == "") {
+			http.Error(w, "missing user_id or device_id", http.StatusBadRequest)
+			return
+		}
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.identifications = append(e.identifications, identifications...)
+	_, _ = io.WriteString(w, "success")
+}
+
+// groupIdentify handles the Group Identify API
+func (e *Emulator) groupIdentify(w http.ResponseWriter, r *http.Request) {
+	var groups []*GroupIdentification
+	if !e.form(w, r, &groups) {
+		return
+	}
+
+	for _, group := range groups {
+		if group == nil || group.GroupType == "" || group.GroupValue == "" {
+			http.Error(w, "missing group_type or group_value", http.StatusBadRequest)
+			return
+		}
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.groups = append(e.groups, groups...)
+	_, _ = io.WriteString(w, "success")
+}
+
+// read reads the request body, failing if it is larger than the limit
+func (e *Emulator) read(r *http.Request, limit int64) ([]byte, bool) {
+	if e.payloadLimit > 0 {
+		limit = e.payloadLimit
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil || int64(len(data)) > limit {
+		return nil, false
+	}
+
+	return data, true
+}
+
+// authenticate checks the api key, returning the error response if it is missing or wrong
+func (e *Emulator) authenticate(key string) *response {
+	if key == "" {
+		return &response{Code: http.StatusBadRequest, Error: "Request missing required field", MissingField: "api_key"}
+	}
+
+	if e.apiKey != "" && key != e.apiKey {
+		return &response{Code: http.StatusBadRequest, Error: fmt.Sprintf("Invalid API key: %s", key)}
+	}
+
+	return nil
+}
+
+// form decodes the identification form field of the identify endpoints,
+// which may be a single JSON object or an array of objects
+func (e *Emulator) form(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	data, ok := e.read(r, DefaultHTTPPayloadLimit)
+	if !ok {
+		http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+		return false
+	}
+
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		http.Error(w, "invalid form body", http.StatusBadRequest)
+		return false
+	}
+
+	if res := e.authenticate(values.Get("api_key")); res != nil {
+		http.Error(w, res.Error, http.StatusBadRequest)
+		return false
+	}
+
+	identification := values.Get("identification")
+	if identification == "" {
+		http.Error(w, "missing identification", http.StatusBadRequest)
+		return false
+	}
+
+	if err := json.Unmarshal([]byte(identification), v); err != nil {
+		if err := json.Unmarshal([]byte("["+identification+"]"), v); err != nil {
+			http.Error(w, "invalid identification", http.StatusBadRequest)
+			return false
+		}
+	}
+
+	return true
+}
+
+// throttle counts the events of each user and device in their current window,
+// returning the error response if any of them exceeds the rate
+func (e *Emulator) throttle(events []*amplitude.Event) *response {
+	if e.eventsPerSecond <= 0 {
+		return nil
+	}
+
+	counts := make(map[identity]int)
+	for _, event := range events {
+		if event.UserId != "" {
+			counts[identity{user: true, id: event.UserId}]++
+		}
+
+		if event.DeviceId != "" {
+			counts[identity{id: event.DeviceId}]++
+		}
+	}
+
+	res := response{
+		Code:             http.StatusTooManyRequests,
+		Error:            "Too many requests for some devices and users",
+		EPSThreshold:     e.eventsPerSecond,
+		ThrottledDevices: make(map[string]int),
+		ThrottledUsers:   make(map[string]int),
+	}
+
+	now := e.now()
+	windows := make(map[identity]*window, len(counts))
+	for key, n := range counts {
+		w := e.windows[key]
+		if w == nil || now.Sub(w.start) >= time.Second {
+			w = &window{start: now}
+		}
+		windows[key] = w
+
+		if w.count+n > e.eventsPerSecond {
+			if key.user {
+				res.ThrottledUsers[key.id] = w.count + n
+			} else {
+				res.ThrottledDevices[key.id] = w.count + n
+			}
+		}
+	}
+
+	if len(res.ThrottledUsers) == 0 && len(res.ThrottledDevices) == 0 {
+		for key, w := range windows {
+			w.count += counts[key]
+			e.windows[key] = w
+		}
+
+		return nil
+	}
+
+	for i, event := range events {
+		_, user := res.ThrottledUsers[event.UserId]
+		_, device := res.ThrottledDevices[event.DeviceId]
+		if user || device {
+			res.ThrottledEvents = append(res.ThrottledEvents, i)
+		}
+	}
+
+	return &res
+}
+
+// validate checks the events for missing and invalid fields the way Amplitude does
+func validate(events []*amplitude.Event) *response {
+	missing := make(map[string][]int)
+	invalid := make(map[string][]int)
+	for i, event := range events {
+		if event == nil {
+			missing["event_type"] = append(missing["event_type"], i)
+			continue
+		}
+
+		err := event.Validate()
+		if err == nil {
+			continue
+		}
+
+		verr := err.(*amplitude.ValidationError)
+		for _, field := range verr.Missing {
+			missing[field] = append(missing[field], i)
+		}
+
+		for _, field := range verr.Invalid {
+			invalid[field] = append(invalid[field], i)
+		}
+	}
+
+	switch {
+	case len(missing) > 0:
+		return &response{Code: http.StatusBadRequest, Error: "Request missing required field", MissingFields: missing, InvalidFields: invalid}
+	case len(invalid) > 0:
+		return &response{Code: http.StatusBadRequest, Error: "Invalid field values on some events", InvalidFields: invalid}
+	}
+
+	return nil
+}
+
+// writeJSON writes the response with its code as the status
+func writeJSON(w http.ResponseWriter, res response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(res.Code)
+	_ = json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,261 @@
+package amplitudetest
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pghq/go-amplitude/amplitude"
+)
+
+// Fault is a failure injected into an upload, the zero value lets the upload through
+type Fault struct {
+	// Latency delays handling the upload
+	Latency time.Duration
+
+	// Reset closes the connection without responding
+	Reset bool
+
+	// Status responds with the server error status instead of ingesting the events
+	Status int
+
+	// Throttle responds with 429 instead of ingesting the events
+	Throttle bool
+
+	// Reject rejects the matching events with a 400 response while ingesting the others
+	Reject Matcher
+
+	// Ingest ingests the events before resetting, failing or throttling,
+	// as if the response was lost on its way back to the client
+	Ingest bool
+}
+
+// Scenario decides the fault injected into the nth upload (counting from zero), nil for none
+type Scenario func(n int) *Fault
+
+// Script injects the faults into the uploads in order, the uploads following them are let through
+func Script(faults ...Fault) Scenario {
+	return func(n int) *Fault {
+		if n < len(faults) {
+			return &faults[n]
+		}
+
+		return nil
+	}
+}
+
+// Every injects the fault into every nth upload
+func Every(n int, fault Fault) Scenario {
+	return func(i int) *Fault {
+		if n > 0 && (i+1)%n == 0 {
+			return &fault
+		}
+
+		return nil
+	}
+}
+
+// Window injects the fault into the uploads from the first up to, but not including, the last
+func Window(first, last int, fault Fault) Scenario {
+	return func(n int) *Fault {
+		if n >= first && n < last {
+			return &fault
+		}
+
+		return nil
+	}
+}
+
+// Scenarios combines scenarios, injecting the fault of the first one deciding on one
+func Scenarios(scenarios ...Scenario) Scenario {
+	return func(n int) *Fault {
+		for _, scenario := range scenarios {
+			if fault := scenario(n); fault != nil {
+				return fault
+			}
+		}
+
+		return nil
+	}
+}
+
+// Scenario sets the faults injected into uploads, counting uploads from the next one
+func (e *Emulator) Scenario(s Scenario) *Emulator {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.scenario = s
+	e.uploads = 0
+	return e
+}
+
+// fault gets the fault of the next upload
+func (e *Emulator) fault() *Fault {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	n := e.uploads
+	e.uploads++
+	if e.scenario == nil {
+		return nil
+	}
+
+	return e.scenario(n)
+}
+
+// delay waits out the latency of the fault, returning false if the request was cancelled meanwhile
+func (f *Fault) delay(r *http.Request) bool {
+	if f == nil || f.Latency <= 0 {
+		return true
+	}
+
+	t := time.NewTimer(f.Latency)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// ingests checks if the events are ingested before failing
+func (f *Fault) ingests() bool {
+	return f != nil && f.Ingest
+}
+
+// fail resets the connection or responds with the error of the fault, returning true if it did
+func (f *Fault) fail(w http.ResponseWriter, events []*amplitude.Event) bool {
+	switch {
+	case f == nil:
+		return false
+	case f.Reset:
+		reset(w)
+	case f.Status != 0:
+		writeJSON(w, response{Code: f.Status, Error: http.StatusText(f.Status)})
+	case f.Throttle:
+		res := response{
+			Code:           http.StatusTooManyRequests,
+			Error:          "Too many requests for some devices and users",
+			ThrottledUsers: make(map[string]int),
+		}
+
+		for i, event := range events {
+			if event != nil && event.UserId != "" {
+				res.ThrottledUsers[event.UserId]++
+			}
+			res.ThrottledEvents = append(res.ThrottledEvents, i)
+		}
+
+		writeJSON(w, res)
+	default:
+		return false
+	}
+
+	return true
+}
+
+// reject splits the events into those ingested and the indices of those rejected by the fault
+func (f *Fault) reject(events []*amplitude.Event) ([]*amplitude.Event, []int) {
+	if f == nil || f.Reject == nil {
+		return events, nil
+	}
+
+	var accepted []*amplitude.Event
+	var rejected []int
+	for i, event := range events {
+		if f.Reject(event) {
+			rejected = append(rejected, i)
+			continue
+		}
+
+		accepted = append(accepted, event)
+	}
+
+	return accepted, rejected
+}
+
+// reset closes the connection of the response abruptly so the client sees a connection reset
+func reset(w http.ResponseWriter) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		panic(http.ErrAbortHandler)
+	}
+
+	conn, _, err := hj.Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		_ = tcp.SetLinger(0)
+	}
+
+	_ = conn.Close()
+}
+
+// Report is the outcome of the events accepted for delivery, matched by insert id
+type Report struct {
+	// Delivered are the accepted events received exactly once
+	Delivered []*amplitude.Event
+
+	// Duplicated are the accepted events received more than once
+	Duplicated []*amplitude.Event
+
+	// Lost are the accepted events never received
+	Lost []*amplitude.Event
+
+	// Unexpected are the events received which were not accepted
+	Unexpected []*amplitude.Event
+
+	// Received is the number of times each insert id was received
+	Received map[string]int
+}
+
+// Report compares the events received with those accepted for delivery (e.g. by SendMiddleware.Send),
+// accepted events without an insert id were never uploaded and are reported lost
+func (e *Emulator) Report(accepted ...*amplitude.Event) *Report {
+	report := Report{Received: make(map[string]int)}
+
+	var unexpected []*amplitude.Event
+	for _, event := range e.Events() {
+		if report.Received[event.InsertId] == 0 {
+			unexpected = append(unexpected, event)
+		}
+		report.Received[event.InsertId]++
+	}
+
+	expected := make(map[string]bool, len(accepted))
+	for _, event := range accepted {
+		expected[event.InsertId] = true
+		switch n := report.Received[event.InsertId]; {
+		case event.InsertId == "" || n == 0:
+			report.Lost = append(report.Lost, event)
+		case n == 1:
+			report.Delivered = append(report.Delivered, event)
+		default:
+			report.Duplicated = append(report.Duplicated, event)
+		}
+	}
+
+	for _, event := range unexpected {
+		if !expected[event.InsertId] {
+			report.Unexpected = append(report.Unexpected, event)
+		}
+	}
+
+	return &report
+}
+
+// OK checks if every accepted event was delivered exactly once and nothing else was received
+func (r *Report) OK() bool {
+	return len(r.Duplicated) == 0 && len(r.Lost) == 0 && len(r.Unexpected) == 0
+}
+
+// String summarizes the report
+func (r *Report) String() string {
+	return fmt.Sprintf("%d delivered, %d duplicated, %d lost, %d unexpected",
+		len(r.Delivered), len(r.Duplicated), len(r.Lost), len(r.Unexpected))
+}
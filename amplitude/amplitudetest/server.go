@@ -0,0 +1,160 @@
+package amplitudetest
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pghq/go-amplitude/amplitude"
+)
+
+// Matcher checks if a received event is the one expected
+type Matcher func(event *amplitude.Event) bool
+
+// User matches events of the user
+func User(id string) Matcher {
+	return func(event *amplitude.Event) bool {
+		return event.UserId == id
+	}
+}
+
+// Device matches events of the device
+func Device(id string) Matcher {
+	return func(event *amplitude.Event) bool {
+		return event.DeviceId == id
+	}
+}
+
+// Property matches events with the event property set to the value
+func Property(key string, value interface{}) Matcher {
+	value = normalize(value)
+	return func(event *amplitude.Event) bool {
+		v, ok := event.Properties[key]
+		return ok && reflect.DeepEqual(v, value)
+	}
+}
+
+// UserProperty matches events with the user property set to the value
+func UserProperty(key string, value interface{}) Matcher {
+	value = normalize(value)
+	return func(event *amplitude.Event) bool {
+		v, ok := event.UserProperties[key]
+		return ok && reflect.DeepEqual(v, value)
+	}
+}
+
+// All matches events matching every matcher
+func All(matchers ...Matcher) Matcher {
+	return func(event *amplitude.Event) bool {
+		for _, matcher := range matchers {
+			if matcher != nil && !matcher(event) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+// Server is an emulator listening on a local test server
+type Server struct {
+	*Emulator
+
+	// URL of the server, used as the base URL of clients
+	URL string
+
+	t      testing.TB
+	server *httptest.Server
+}
+
+// NewServer starts an emulator which is closed when the test completes
+func NewServer(t testing.TB) *Server {
+	e := NewEmulator()
+	ts := httptest.NewServer(e)
+	t.Cleanup(ts.Close)
+
+	s := Server{
+		Emulator: e,
+		URL:      ts.URL,
+		t:        t,
+		server:   ts,
+	}
+
+	return &s
+}
+
+// Client creates an amplitude client sending to the server
+func (s *Server) Client(apiKey string) *amplitude.Client {
+	c := amplitude.New(apiKey)
+	c.BaseURL, _ = url.Parse(s.URL)
+	return c
+}
+
+// Close shuts down the server
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// ExpectEvent fails the test unless an event with the name matching the matcher was received
+func (s *Server) ExpectEvent(name string, matcher Matcher) *amplitude.Event {
+	s.t.Helper()
+
+	events := s.Find(name, matcher)
+	if len(events) == 0 {
+		s.t.Errorf("amplitudetest: expected a matching %s event, received %s", name, s.received())
+		return nil
+	}
+
+	return events[0]
+}
+
+// ExpectNoEvent fails the test if an event with the name matching the matcher was received
+func (s *Server) ExpectNoEvent(name string, matcher Matcher) {
+	s.t.Helper()
+
+	if events := s.Find(name, matcher); len(events) > 0 {
+		s.t.Errorf("amplitudetest: expected no matching %s event, received %d", name, len(events))
+	}
+}
+
+// ExpectDelivered fails the test unless every accepted event was received exactly once
+func (s *Server) ExpectDelivered(accepted ...*amplitude.Event) *Report {
+	s.t.Helper()
+
+	report := s.Report(accepted...)
+	if !report.OK() {
+		s.t.Errorf("amplitudetest: expected every event to be delivered exactly once, %s", report)
+	}
+
+	return report
+}
+
+// received lists the names of the events received for failure messages
+func (s *Server) received() string {
+	events := s.Events()
+	if len(events) == 0 {
+		return "no events"
+	}
+
+	names := make([]string, len(events))
+	for i, event := range events {
+		names[i] = event.Name
+	}
+
+	return "[" + strings.Join(names, ", ") + "]"
+}
+
+// normalize converts a value to its JSON representation so it compares equal to decoded properties
+func normalize(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+
+	var n interface{}
+	_ = json.Unmarshal(data, &n)
+	return n
+}
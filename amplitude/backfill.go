@@ -0,0 +1,506 @@
+package amplitude
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pghq/go-museum/museum/diagnostic/errors"
+)
+
+const (
+	// DefaultBackfillBatchSize is the max number of events per backfill request
+	DefaultBackfillBatchSize = 1000
+
+	// DefaultBackfillBatchBytes is the max payload size of backfill requests (half the Batch API limit)
+	DefaultBackfillBatchBytes = 10 << 20
+
+	// DefaultBackfillRetries is the number of times a failed backfill request is retried
+	DefaultBackfillRetries = 5
+)
+
+// EventSource reads the events to backfill, always in the same order so interrupted imports can resume
+type EventSource interface {
+	// Next gets the next event, returning io.EOF once every event has been read
+	Next() (*Event, error)
+}
+
+// EventSourceFunc is a function reading events to backfill
+type EventSourceFunc func() (*Event, error)
+
+// Next implements the EventSource interface
+func (fn EventSourceFunc) Next() (*Event, error) {
+	return fn()
+}
+
+// NewEventSource creates a source reading the events in order
+func NewEventSource(events ...*Event) EventSource {
+	var i int
+	return EventSourceFunc(func() (*Event, error) {
+		if i >= len(events) {
+			return nil, io.EOF
+		}
+
+		i++
+		return events[i-1], nil
+	})
+}
+
+// NewJSONSource creates a source decoding a stream of JSON events (e.g. JSON lines)
+func NewJSONSource(r io.Reader) EventSource {
+	dec := json.NewDecoder(r)
+	return EventSourceFunc(func() (*Event, error) {
+		var event Event
+		if err := dec.Decode(&event); err != nil {
+			return nil, err
+		}
+
+		return &event, nil
+	})
+}
+
+// Backfill imports historical events in bounded, rate limited batches,
+// recording its progress in a checkpoint so an interrupted import resumes where it left off
+type Backfill struct {
+	client      *Client
+	source      EventSource
+	batchSize   int
+	batchBytes  int
+	concurrency int
+	rate        float64
+	retries     int
+	retryWait   time.Duration
+	checkpoint  string
+}
+
+// BackfillReport is the outcome of a backfill
+type BackfillReport struct {
+	// Ingested is the number of events accepted by Amplitude
+	Ingested int
+
+	// Rejected is the number of events which are invalid or were refused by Amplitude
+	Rejected int
+
+	// Skipped is the number of events imported before the checkpoint or dropped as duplicates
+	Skipped int
+
+	// Batches is the number of batches sent
+	Batches int
+
+	// Offset is the number of events of the source processed, as saved in the checkpoint
+	Offset int
+
+	// Errors are the reasons events were rejected
+	Errors []error
+
+	// Duration is how long the backfill ran
+	Duration time.Duration
+}
+
+// String summarizes the report
+func (r *BackfillReport) String() string {
+	return fmt.Sprintf("%d events ingested, %d rejected, %d skipped in %d batches (%s)",
+		r.Ingested, r.Rejected, r.Skipped, r.Batches, r.Duration.Round(time.Millisecond))
+}
+
+// backfillBatch is a range of events of the source
+type backfillBatch struct {
+	seq        int
+	end        int
+	events     []*Event
+	invalid    []error
+	ingested   int
+	skipped    int
+	rejected   int
+	rejections []error
+	err        error
+}
+
+// backfillCheckpoint is the progress saved by a backfill
+type backfillCheckpoint struct {
+	Offset int `json:"offset"`
+}
+
+// NewBackfill creates a backfill of the events of the source
+func (c *Client) NewBackfill(source EventSource) *Backfill {
+	b := Backfill{
+		client:      c,
+		source:      source,
+		batchSize:   DefaultBackfillBatchSize,
+		batchBytes:  DefaultBackfillBatchBytes,
+		concurrency: 1,
+		retries:     DefaultBackfillRetries,
+		retryWait:   time.Second,
+	}
+
+	return &b
+}
+
+// BatchSize sets the max number of events and payload size of each request
+func (b *Backfill) BatchSize(events, bytes int) *Backfill {
+	if events > 0 {
+		b.batchSize = events
+	}
+
+	if bytes > 0 {
+		b.batchBytes = bytes
+	}
+
+	return b
+}
+
+// Concurrency sets the number of requests sent at once
+func (b *Backfill) Concurrency(n int) *Backfill {
+	if n > 0 {
+		b.concurrency = n
+	}
+
+	return b
+}
+
+// Rate sets the max number of events sent per second, the rate is unlimited if not positive
+func (b *Backfill) Rate(eventsPerSecond float64) *Backfill {
+	b.rate = eventsPerSecond
+	return b
+}
+
+// Retries sets the number of times failed requests are retried and the wait between attempts
+func (b *Backfill) Retries(n int, wait time.Duration) *Backfill {
+	b.retries = n
+	b.retryWait = wait
+	return b
+}
+
+// Checkpoint sets the file the progress is saved to and resumed from
+func (b *Backfill) Checkpoint(path string) *Backfill {
+	b.checkpoint = path
+	return b
+}
+
+// Run imports the events, returning once the source is exhausted or a request fails for good.
+// Events without an insert id are given a deterministic one so events sent again after resuming
+// are deduplicated by Amplitude.
+func (b *Backfill) Run(ctx context.Context) (*BackfillReport, error) {
+	start := time.Now()
+	offset, err := b.load()
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	report := BackfillReport{Offset: offset}
+	for report.Skipped < offset {
+		if _, err := b.source.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrap(err)
+		}
+		report.Skipped++
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	batches := make(chan *backfillBatch)
+	results := make(chan *backfillBatch)
+	var readErr error
+	go func() {
+		defer close(batches)
+		readErr = b.read(ctx, offset, batches)
+	}()
+
+	// the first batch failing for good stops the backfill, later failures are caused by stopping it
+	var failOnce sync.Once
+	var failed error
+	done := make(chan struct{})
+	for i := 0; i < b.concurrency; i++ {
+		go func() {
+			for batch := range batches {
+				if b.send(ctx, batch); batch.err != nil {
+					failOnce.Do(func() {
+						failed = batch.err
+						cancel()
+					})
+				}
+				results <- batch
+			}
+			done <- struct{}{}
+		}()
+	}
+
+	go func() {
+		for i := 0; i < b.concurrency; i++ {
+			<-done
+		}
+		close(results)
+	}()
+
+	// batches complete out of order, the checkpoint only moves past batches which all completed
+	var saveErr error
+	next, pending := 0, make(map[int]*backfillBatch)
+	for batch := range results {
+		if len(batch.events) > 0 {
+			report.Batches++
+		}
+
+		report.Rejected += len(batch.invalid) + batch.rejected
+		report.Errors = append(report.Errors, batch.invalid...)
+		report.Errors = append(report.Errors, batch.rejections...)
+		if batch.err == nil {
+			report.Ingested += batch.ingested
+			report.Skipped += batch.skipped
+		}
+
+		pending[batch.seq] = batch
+		advanced := false
+		for pending[next] != nil && pending[next].err == nil {
+			report.Offset = pending[next].end
+			advanced = true
+			delete(pending, next)
+			next++
+		}
+
+		if !advanced {
+			continue
+		}
+
+		if err := b.save(report.Offset); err != nil && saveErr == nil {
+			saveErr = err
+			cancel()
+		}
+	}
+
+	report.Duration = time.Since(start)
+	for _, err := range []error{saveErr, failed, readErr} {
+		if err != nil {
+			return &report, errors.Wrap(err)
+		}
+	}
+
+	return &report, nil
+}
+
+// read splits the events of the source following the offset into batches
+func (b *Backfill) read(ctx context.Context, offset int, batches chan<- *backfillBatch) error {
+	var next time.Time
+	batch := &backfillBatch{end: offset}
+	var size int
+	emit := func() error {
+		if err := b.pace(ctx, &next, len(batch.events)); err != nil {
+			return err
+		}
+
+		select {
+		case batches <- batch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		batch = &backfillBatch{seq: batch.seq + 1, end: batch.end}
+		size = 0
+		return nil
+	}
+
+	for {
+		event, err := b.source.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := event.Validate(); err != nil {
+			verr := err.(*ValidationError)
+			verr.Index = batch.end
+			batch.invalid = append(batch.invalid, verr)
+			batch.end++
+			continue
+		}
+
+		if event.InsertId == "" {
+			event.InsertId = DeterministicInsertId(event)
+		}
+
+		data, _ := json.Marshal(event)
+		if len(batch.events) > 0 && size+len(data) > b.batchBytes {
+			if err := emit(); err != nil {
+				return err
+			}
+		}
+
+		batch.events = append(batch.events, event)
+		batch.end++
+		size += len(data)
+		if len(batch.events) >= b.batchSize {
+			if err := emit(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(batch.events) > 0 || len(batch.invalid) > 0 {
+		return emit()
+	}
+
+	return nil
+}
+
+// pace waits until the events may be sent at the rate, next is when the following events may be sent
+func (b *Backfill) pace(ctx context.Context, next *time.Time, n int) error {
+	if b.rate <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	if next.Before(now) {
+		*next = now
+	}
+
+	wait := next.Sub(now)
+	*next = next.Add(time.Duration(float64(n) / b.rate * float64(time.Second)))
+	return sleep(ctx, wait)
+}
+
+// send uploads the events of the batch
+func (b *Backfill) send(ctx context.Context, batch *backfillBatch) {
+	if len(batch.events) == 0 {
+		return
+	}
+
+	if err := ctx.Err(); err != nil {
+		batch.err = err
+		return
+	}
+
+	batch.err = b.upload(ctx, batch, batch.events)
+}
+
+// upload sends events of the batch, splitting payloads which are too large and retrying requests which may succeed later
+func (b *Backfill) upload(ctx context.Context, batch *backfillBatch, events []*Event) error {
+	for attempt := 0; ; attempt++ {
+		resp, err := b.client.Events.Send(ctx, events...)
+		if err == nil {
+			batch.ingested += resp.EventsIngested
+			batch.skipped += len(events) - resp.EventsIngested - len(resp.Invalid) - len(resp.Blocked)
+			for _, verr := range resp.Invalid {
+				batch.invalid = append(batch.invalid, verr)
+			}
+
+			for _, violation := range resp.Blocked {
+				batch.invalid = append(batch.invalid, violation)
+			}
+			return nil
+		}
+
+		// the halves of a batch which is too large may be accepted, only a single event too large is rejected
+		if tooLarge(err) && len(events) > 1 {
+			half := len(events) / 2
+			if err := b.upload(ctx, batch, events[:half]); err != nil {
+				return err
+			}
+
+			return b.upload(ctx, batch, events[half:])
+		}
+
+		if rejected(err) {
+			batch.rejected += len(events)
+			batch.rejections = append(batch.rejections, err)
+			return nil
+		}
+
+		if attempt >= b.retries || ctx.Err() != nil {
+			return err
+		}
+
+		if err := sleep(ctx, b.retryWait*time.Duration(attempt+1)); err != nil {
+			return err
+		}
+	}
+}
+
+// tooLarge checks if an error is caused by the size of the payload
+func tooLarge(err error) bool {
+	aerr, ok := err.(*Error)
+	return ok && aerr.Response.StatusCode == http.StatusRequestEntityTooLarge
+}
+
+// rejected checks if an error is caused by the events themselves, so sending them again would fail too
+func rejected(err error) bool {
+	switch err := err.(type) {
+	case ValidationErrors:
+		return true
+	case *Error:
+		status := err.Response.StatusCode
+		return status >= 400 && status < 500 && status != 429
+	}
+
+	return false
+}
+
+// load reads the offset saved in the checkpoint
+func (b *Backfill) load() (int, error) {
+	if b.checkpoint == "" {
+		return 0, nil
+	}
+
+	data, err := os.ReadFile(b.checkpoint)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	var checkpoint backfillCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return 0, err
+	}
+
+	return checkpoint.Offset, nil
+}
+
+// save writes the offset to the checkpoint, replacing it atomically
+func (b *Backfill) save(offset int) error {
+	if b.checkpoint == "" {
+		return nil
+	}
+
+	data, _ := json.Marshal(backfillCheckpoint{Offset: offset})
+	f, err := os.CreateTemp(filepath.Dir(b.checkpoint), filepath.Base(b.checkpoint)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), b.checkpoint)
+}
+
+// sleep waits for the duration or until the context is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -19,6 +19,12 @@ type BatchEventsSuccessSummary struct {
 	EventsIngested int   `json:"events_ingested"`
 	PayloadSize    int   `json:"payload_size_bytes"`
 	UploadTime     int64 `json:"server_upload_time"`
+
+	// Invalid are the diagnostics of the events left out of the upload as Amplitude would reject them
+	Invalid ValidationErrors `json:"-"`
+
+	// Blocked are the violations of the events left out of the upload by the tracking plan in block mode
+	Blocked []*PlanViolation `json:"-"`
 }
 
 // String converts the summary response to a pretty string format.
@@ -32,21 +38,73 @@ func (s *BatchEventsSuccessSummary) String() string {
 // for example through scheduled jobs, rather than in a continuous realtime stream.
 // Due to the higher rate of data that is permitted to this endpoint, data sent to this endpoint
 // may be delayed based on load.
+// Events pass through the client plugins and are validated before being uploaded,
+// once uploaded they are delivered to any registered destinations.
+// Invalid events and events blocked by the tracking plan are left out of the upload and reported in the summary,
+// a batch of only invalid events fails with their ValidationErrors.
 func (s *EventsService) Send(ctx context.Context, events ...*Event) (*BatchEventsSuccessSummary, error) {
+	res, _, err := s.send(ctx, events)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// send uploads the events, returning the events which remained to be uploaded after the plugins,
+// validation and tracking plan. The summary lists the events left out even if the upload failed,
+// it is only nil if the batch could not be prepared.
+func (s *EventsService) send(ctx context.Context, events []*Event) (*BatchEventsSuccessSummary, []*Event, error) {
 	if len(events) == 0 {
-		return nil, errors.New("no events to send")
+		return nil, nil, errors.New("no events to send")
+	}
+
+	for _, event := range events {
+		// enrichment is best effort and should not prevent delivery
+		_ = event.Locate(s.client.geo)
+	}
+
+	events = s.client.execute(ctx, events)
+
+	// invalid events would cause Amplitude to reject the whole batch
+	events, invalid := splitInvalid(events)
+	if len(events) == 0 && len(invalid) > 0 {
+		return &BatchEventsSuccessSummary{Invalid: invalid}, nil, invalid
+	}
+
+	events, blocked := s.client.enforce(ctx, events)
+
+	// every event was dropped by the plugins, the tracking plan or as a duplicate
+	events = s.client.identify(events)
+	if len(events) == 0 {
+		return &BatchEventsSuccessSummary{Code: http.StatusOK, Invalid: invalid, Blocked: blocked}, nil, nil
 	}
 
 	body := s.client.NewRequestBody().WithValue("events", events)
-	req, err := s.client.NewRequest(ctx, http.MethodPost, batchEventUploadEndpoint, body)
+	req, err := s.client.NewRequest(withBatchSize(ctx, len(events)), http.MethodPost, batchEventUploadEndpoint, body)
 	if err != nil {
-		return nil, errors.Wrap(err)
+		return nil, nil, errors.Wrap(err)
 	}
 
-	var res BatchEventsSuccessSummary
+	res := BatchEventsSuccessSummary{Invalid: invalid, Blocked: blocked}
 	if _, err := s.client.Do(req, &res); err != nil {
-		return nil, errors.Wrap(err)
+		// API errors are returned as is so callers can inspect the response
+		if aerr, ok := err.(*Error); ok {
+			return &res, events, aerr
+		}
+
+		return &res, events, errors.Wrap(err)
+	}
+
+	if s.client.dedupe != nil {
+		ids := make([]string, len(events))
+		for i, event := range events {
+			ids[i] = event.InsertId
+		}
+		s.client.dedupe.Add(ids...)
 	}
 
-	return &res, nil
+	// destinations only receive the events Amplitude accepted, their failures are reported separately
+	s.client.deliver(ctx, events)
+	return &res, events, nil
 }
@@ -0,0 +1,199 @@
+package amplitude
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// MinIdLength is the minimum length of user and device ids accepted by Amplitude
+	MinIdLength = 5
+
+	// MaxPropertyKeys is the maximum number of keys in a property map
+	MaxPropertyKeys = 1024
+
+	// MaxPropertyDepth is the maximum nesting depth of property values
+	MaxPropertyDepth = 40
+
+	// MaxEventFuture is how far in the future event times may be
+	MaxEventFuture = time.Hour
+)
+
+// minEventTime is the earliest event time accepted (2000-01-01), earlier
+// times are typically seconds mistakenly sent instead of milliseconds
+var minEventTime = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// BlockedIds are placeholder values Amplitude refuses as user or device ids
+var BlockedIds = []string{
+	"anonymous", "nil", "none", "null", "n/a", "na", "undefined", "unknown", "<nil>",
+	"0", "-1", "00000000-0000-0000-0000-000000000000", "lmy47d", "lmy47o", "lmy47v",
+	"dummy", "nil-device", "unknown-device",
+}
+
+// ValidationError lists the problems found with an event
+type ValidationError struct {
+	Index    int
+	Event    *Event
+	Problems []string
+
+	// Missing and Invalid are the fields of the problems, named as in the Amplitude API
+	Missing []string
+	Invalid []string
+}
+
+// Error implements the error interface
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("amplitude: event %d (%s) is invalid: %s", e.Index, e.Event.Name, strings.Join(e.Problems, "; "))
+}
+
+// missing records a required field which is not set
+func (e *ValidationError) missing(field, problem string) {
+	e.Missing = append(e.Missing, field)
+	e.Problems = append(e.Problems, problem)
+}
+
+// invalid records the problems of a field, if any
+func (e *ValidationError) invalid(field string, problems ...string) {
+	if len(problems) == 0 {
+		return
+	}
+
+	e.Invalid = append(e.Invalid, field)
+	e.Problems = append(e.Problems, problems...)
+}
+
+// ValidationErrors are the diagnostics of every invalid event in a batch
+type ValidationErrors []*ValidationError
+
+// Error implements the error interface
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+
+	return strings.Join(messages, "\n")
+}
+
+// Validate checks the event against Amplitude field constraints
+func (e *Event) Validate() error {
+	verr := ValidationError{Event: e}
+	if e.Name == "" {
+		verr.missing("event_type", "event_type is required")
+	}
+
+	if e.UserId == "" && e.DeviceId == "" {
+		verr.missing("user_id", "user_id or device_id is required")
+	}
+
+	verr.invalid("user_id", validateId("user_id", e.UserId)...)
+	verr.invalid("device_id", validateId("device_id", e.DeviceId)...)
+
+	if e.Time != 0 {
+		var problems []string
+		t := time.Unix(0, e.Time*int64(time.Millisecond))
+		if t.Before(minEventTime) {
+			problems = append(problems, fmt.Sprintf("time %d is before %s (expected milliseconds)", e.Time, minEventTime.Format("2006-01-02")))
+		}
+
+		if t.After(time.Now().Add(MaxEventFuture)) {
+			problems = append(problems, fmt.Sprintf("time %d is in the future", e.Time))
+		}
+
+		verr.invalid("time", problems...)
+	}
+
+	verr.invalid("event_properties", validateProperties("event_properties", e.Properties)...)
+	verr.invalid("user_properties", validateProperties("user_properties", e.UserProperties)...)
+	verr.invalid("groups", validateProperties("groups", e.Groups)...)
+	verr.invalid("group_properties", validateProperties("group_properties", e.GroupProperties)...)
+
+	if len(verr.Problems) > 0 {
+		return &verr
+	}
+
+	return nil
+}
+
+// ValidateEvents checks each event in the batch, returning the diagnostics of the invalid events
+func ValidateEvents(events ...*Event) error {
+	if _, errs := splitInvalid(events); len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// splitInvalid separates the events Amplitude would reject from the batch
+func splitInvalid(events []*Event) ([]*Event, ValidationErrors) {
+	var errs ValidationErrors
+	valid := events[:0:0]
+	for i, event := range events {
+		if err := event.Validate(); err != nil {
+			verr := err.(*ValidationError)
+			verr.Index = i
+			errs = append(errs, verr)
+			continue
+		}
+
+		valid = append(valid, event)
+	}
+
+	return valid, errs
+}
+
+// validateId checks the length and value of an id
+func validateId(field, id string) []string {
+	if id == "" {
+		return nil
+	}
+
+	var problems []string
+	if len(id) < MinIdLength {
+		problems = append(problems, fmt.Sprintf("%s %q is shorter than %d characters", field, id, MinIdLength))
+	}
+
+	if contains(BlockedIds, id) {
+		problems = append(problems, fmt.Sprintf("%s %q is a blocked value", field, id))
+	}
+
+	return problems
+}
+
+// validateProperties checks the key count and nesting depth of a property map
+func validateProperties(field string, props map[string]interface{}) []string {
+	var problems []string
+	if len(props) > MaxPropertyKeys {
+		problems = append(problems, fmt.Sprintf("%s has %d keys, more than %d", field, len(props), MaxPropertyKeys))
+	}
+
+	if depth := propertyDepth(props); depth > MaxPropertyDepth {
+		problems = append(problems, fmt.Sprintf("%s is nested %d levels, more than %d", field, depth, MaxPropertyDepth))
+	}
+
+	return problems
+}
+
+// propertyDepth measures how deeply a property value is nested
+func propertyDepth(v interface{}) int {
+	var depth int
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, e := range v {
+			if d := propertyDepth(e); d > depth {
+				depth = d
+			}
+		}
+	case []interface{}:
+		for _, e := range v {
+			if d := propertyDepth(e); d > depth {
+				depth = d
+			}
+		}
+	default:
+		return 0
+	}
+
+	return depth + 1
+}
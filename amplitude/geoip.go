@@ -0,0 +1,231 @@
+package amplitude
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/pghq/go-museum/museum/diagnostic/errors"
+)
+
+const (
+	// DefaultGeoIPReloadInterval is how often the database file is checked for changes
+	DefaultGeoIPReloadInterval = time.Minute
+)
+
+// Location is the geographic information of an address
+type Location struct {
+	Country   string
+	Region    string
+	City      string
+	DMA       string
+	Latitude  float64
+	Longitude float64
+}
+
+// GeoLocator looks up the location of addresses
+type GeoLocator interface {
+	Locate(ip net.IP) (*Location, error)
+}
+
+// GeoIP is a GeoLocator backed by a local MaxMind (MMDB) database
+// which is reloaded when the file changes. Updates should replace
+// the file atomically (e.g. by renaming) as the open database is memory mapped.
+type GeoIP struct {
+	path     string
+	interval time.Duration
+
+	lock    sync.RWMutex
+	reader  *maxminddb.Reader
+	modTime time.Time
+	checked time.Time
+}
+
+// OpenGeoIP opens a MaxMind city database
+func OpenGeoIP(path string) (*GeoIP, error) {
+	g := GeoIP{
+		path:     path,
+		interval: DefaultGeoIPReloadInterval,
+	}
+
+	if err := g.Reload(); err != nil {
+		return nil, err
+	}
+
+	return &g, nil
+}
+
+// ReloadInterval sets how often the database file is checked for changes
+func (g *GeoIP) ReloadInterval(d time.Duration) *GeoIP {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.interval = d
+	return g
+}
+
+// Reload opens the database file again if it has been modified
+func (g *GeoIP) Reload() error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	return g.reload()
+}
+
+// Close releases the database
+func (g *GeoIP) Close() error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.reader == nil {
+		return nil
+	}
+
+	err := g.reader.Close()
+	g.reader = nil
+	return err
+}
+
+// Locate looks up the location of the address, a nil location is returned when unknown
+func (g *GeoIP) Locate(ip net.IP) (*Location, error) {
+	if err := g.refresh(); err != nil {
+		return nil, err
+	}
+
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	if g.reader == nil {
+		return nil, errors.New("amplitude: geoip database is closed")
+	}
+
+	var record geoRecord
+	if err := g.reader.Lookup(ip, &record); err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	return record.location(), nil
+}
+
+// refresh reloads the database if the reload interval has passed
+func (g *GeoIP) refresh() error {
+	g.lock.RLock()
+	stale := g.reader != nil && time.Since(g.checked) >= g.interval
+	g.lock.RUnlock()
+
+	if !stale {
+		return nil
+	}
+
+	return g.Reload()
+}
+
+// reload swaps in a new reader when the database file has changed
+func (g *GeoIP) reload() error {
+	g.checked = time.Now()
+	info, err := os.Stat(g.path)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	if g.reader != nil && info.ModTime().Equal(g.modTime) {
+		return nil
+	}
+
+	reader, err := maxminddb.Open(g.path)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	if g.reader != nil {
+		_ = g.reader.Close()
+	}
+
+	g.reader = reader
+	g.modTime = info.ModTime()
+	return nil
+}
+
+// geoRecord is the subset of the MaxMind city schema used for events
+type geoRecord struct {
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Country struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	Location struct {
+		Latitude  float64 `maxminddb:"latitude"`
+		Longitude float64 `maxminddb:"longitude"`
+		MetroCode uint    `maxminddb:"metro_code"`
+	} `maxminddb:"location"`
+}
+
+// location converts the record, returning nil if the address was not found
+func (r geoRecord) location() *Location {
+	l := Location{
+		Country:   r.Country.Names["en"],
+		City:      r.City.Names["en"],
+		Latitude:  r.Location.Latitude,
+		Longitude: r.Location.Longitude,
+	}
+
+	if len(r.Subdivisions) > 0 {
+		l.Region = r.Subdivisions[0].Names["en"]
+	}
+
+	if r.Location.MetroCode != 0 {
+		l.DMA = strconv.FormatUint(uint64(r.Location.MetroCode), 10)
+	}
+
+	if l == (Location{}) {
+		return nil
+	}
+
+	return &l
+}
+
+// Locate fills in the location of the event from its IP address
+// if the event does not already have a country set
+func (e *Event) Locate(l GeoLocator) error {
+	if l == nil || e.IP == "" || e.Country != "" {
+		return nil
+	}
+
+	ip := net.ParseIP(e.IP)
+	if ip == nil {
+		return nil
+	}
+
+	loc, err := l.Locate(ip)
+	if err != nil || loc == nil {
+		return err
+	}
+
+	e.Country = loc.Country
+	e.Region = loc.Region
+	e.City = loc.City
+	e.DMA = loc.DMA
+	e.Latitude = loc.Latitude
+	e.Longitude = loc.Longitude
+
+	return nil
+}
+
+// GeoLocator sets the locator used to enrich events before client addresses are anonymized
+func (m *SendMiddleware) GeoLocator(l GeoLocator) *SendMiddleware {
+	m.geo = l
+	return m
+}
+
+// WithGeoLocator sets the locator used to enrich events with an IP address but no location before sending
+func (c *Client) WithGeoLocator(l GeoLocator) *Client {
+	c.geo = l
+	return c
+}
@@ -0,0 +1,157 @@
+package amplitude
+
+import (
+	"container/list"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// InsertIdFunc generates the insert id of events sent without one
+type InsertIdFunc func(event *Event) string
+
+// RandomInsertId generates a random (version 4) UUID
+func RandomInsertId(_ *Event) string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// DeterministicInsertId derives the insert id from the contents of the event,
+// so identical events are only ingested once by Amplitude
+func DeterministicInsertId(event *Event) string {
+	e := *event
+	e.InsertId = ""
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// WithInsertId sets how insert ids are generated for events sent without one,
+// random ids are generated by default
+func (c *Client) WithInsertId(fn InsertIdFunc) *Client {
+	if fn != nil {
+		c.insertId = fn
+	}
+
+	return c
+}
+
+// WithDedupe sets the cache used to drop events whose insert id was recently sent
+func (c *Client) WithDedupe(cache *DedupeCache) *Client {
+	c.dedupe = cache
+	return c
+}
+
+// DedupeCache is a bounded, time-windowed set of recently sent insert ids
+type DedupeCache struct {
+	size   int
+	window time.Duration
+	now    func() time.Time
+
+	lock    sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// dedupeEntry is an insert id and the time it was sent
+type dedupeEntry struct {
+	id   string
+	sent time.Time
+}
+
+// NewDedupeCache creates a cache remembering up to size insert ids for the window
+func NewDedupeCache(size int, window time.Duration) *DedupeCache {
+	d := DedupeCache{
+		size:    size,
+		window:  window,
+		now:     time.Now,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+
+	return &d
+}
+
+// Seen checks if the insert id was sent within the window
+func (d *DedupeCache) Seen(id string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.expire()
+	_, ok := d.entries[id]
+	return ok
+}
+
+// Add remembers the insert ids as sent, evicting the oldest ids when full
+func (d *DedupeCache) Add(ids ...string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	now := d.now()
+	for _, id := range ids {
+		if el, ok := d.entries[id]; ok {
+			d.order.Remove(el)
+		}
+
+		d.entries[id] = d.order.PushBack(&dedupeEntry{id: id, sent: now})
+	}
+
+	for d.size > 0 && d.order.Len() > d.size {
+		d.remove(d.order.Front())
+	}
+
+	d.expire()
+}
+
+// Len gets the number of insert ids remembered
+func (d *DedupeCache) Len() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.expire()
+	return d.order.Len()
+}
+
+// expire removes insert ids sent before the window
+func (d *DedupeCache) expire() {
+	cutoff := d.now().Add(-d.window)
+	for el := d.order.Front(); el != nil && el.Value.(*dedupeEntry).sent.Before(cutoff); el = d.order.Front() {
+		d.remove(el)
+	}
+}
+
+// remove forgets an insert id
+func (d *DedupeCache) remove(el *list.Element) {
+	d.order.Remove(el)
+	delete(d.entries, el.Value.(*dedupeEntry).id)
+}
+
+// identify generates missing insert ids and drops events which are duplicates,
+// either within the batch or of events recently sent
+func (c *Client) identify(events []*Event) []*Event {
+	seen := make(map[string]bool, len(events))
+	unique := events[:0:0]
+	for _, event := range events {
+		if event.InsertId == "" {
+			event.InsertId = c.insertId(event)
+		}
+
+		if seen[event.InsertId] || (c.dedupe != nil && c.dedupe.Seen(event.InsertId)) {
+			continue
+		}
+
+		seen[event.InsertId] = true
+		unique = append(unique, event)
+	}
+
+	return unique
+}
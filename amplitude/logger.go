@@ -0,0 +1,170 @@
+package amplitude
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// LogLevel is the importance of a log record, matching the slog levels
+type LogLevel int
+
+const (
+	// LogDebug traces the requests and responses exchanged with Amplitude
+	LogDebug LogLevel = -4
+
+	// LogInfo reports the uploads of the middleware
+	LogInfo LogLevel = 0
+
+	// LogWarn reports problems which do not prevent delivery
+	LogWarn LogLevel = 4
+
+	// LogError reports events which could not be delivered
+	LogError LogLevel = 8
+)
+
+// redacted replaces the api key in traced requests
+const redacted = "[REDACTED]"
+
+// Logger writes the records of the client and middleware, args are alternating keys and values
+type Logger interface {
+	Enabled(ctx context.Context, level LogLevel) bool
+	Log(ctx context.Context, level LogLevel, msg string, args ...interface{})
+}
+
+// NopLogger discards every record, it is the default logger
+var NopLogger Logger = nopLogger{}
+
+// nopLogger is a logger discarding every record
+type nopLogger struct{}
+
+// Enabled implements the Logger interface
+func (nopLogger) Enabled(context.Context, LogLevel) bool {
+	return false
+}
+
+// Log implements the Logger interface
+func (nopLogger) Log(context.Context, LogLevel, string, ...interface{}) {}
+
+// internalLogKey is the context key marking the records logged by this package
+type internalLogKey struct{}
+
+// internal checks if the record of the context was logged by this package
+func internal(ctx context.Context) bool {
+	marked, _ := ctx.Value(internalLogKey{}).(bool)
+	return marked
+}
+
+// slogLogger writes records to a slog logger
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger creates a logger writing to the slog logger, or the default one if nil
+func NewSlogLogger(l *slog.Logger) Logger {
+	if l == nil {
+		l = slog.Default()
+	}
+
+	return slogLogger{logger: l}
+}
+
+// Enabled implements the Logger interface
+func (l slogLogger) Enabled(ctx context.Context, level LogLevel) bool {
+	return l.logger.Enabled(ctx, slog.Level(level))
+}
+
+// Log implements the Logger interface, the records are marked so a SlogHandler does not send them as events
+func (l slogLogger) Log(ctx context.Context, level LogLevel, msg string, args ...interface{}) {
+	l.logger.Log(context.WithValue(ctx, internalLogKey{}, true), slog.Level(level), msg, args...)
+}
+
+// WithLogger sets the logger of the client and of the middleware created from it
+func (c *Client) WithLogger(l Logger) *Client {
+	if l == nil {
+		l = NopLogger
+	}
+
+	c.logger = l
+	return c
+}
+
+// Logger sets the logger of the middleware, which defaults to the logger of its client
+func (m *SendMiddleware) Logger(l Logger) *SendMiddleware {
+	m.logger = l
+	return m
+}
+
+// log gets the logger of the middleware
+func (m *SendMiddleware) log() Logger {
+	if m.logger != nil {
+		return m.logger
+	}
+
+	return m.client.logger
+}
+
+// traceRequest logs the request at the debug level with the api key redacted
+func (c *Client) traceRequest(req *http.Request) {
+	ctx := req.Context()
+	if !c.logger.Enabled(ctx, LogDebug) {
+		return
+	}
+
+	var body []byte
+	if req.GetBody != nil {
+		if r, err := req.GetBody(); err == nil {
+			body, _ = io.ReadAll(r)
+		}
+	}
+
+	c.logger.Log(ctx, LogDebug, "amplitude: sending request",
+		"method", req.Method,
+		"url", c.redact(req.URL.String()),
+		"body", c.redact(string(bytes.TrimSpace(body))))
+}
+
+// traceResponse logs the response at the debug level, its body is buffered so it can still be read
+func (c *Client) traceResponse(req *http.Request, resp *http.Response, start time.Time) {
+	ctx := req.Context()
+	if !c.logger.Enabled(ctx, LogDebug) {
+		return
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	c.logger.Log(ctx, LogDebug, "amplitude: received response",
+		"method", req.Method,
+		"url", c.redact(req.URL.String()),
+		"status", resp.StatusCode,
+		"duration", time.Since(start),
+		"body", c.redact(string(bytes.TrimSpace(body))))
+}
+
+// traceFailure logs the request which failed to get a response at the debug level
+func (c *Client) traceFailure(req *http.Request, err error) {
+	ctx := req.Context()
+	if !c.logger.Enabled(ctx, LogDebug) {
+		return
+	}
+
+	c.logger.Log(ctx, LogDebug, "amplitude: request failed",
+		"method", req.Method,
+		"url", c.redact(req.URL.String()),
+		"error", c.redact(err.Error()))
+}
+
+// redact replaces the api key in the traced text
+func (c *Client) redact(s string) string {
+	if c.APIKey == "" {
+		return s
+	}
+
+	return strings.ReplaceAll(s, c.APIKey, redacted)
+}
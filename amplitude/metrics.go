@@ -0,0 +1,188 @@
+package amplitude
+
+import (
+	"expvar"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pghq/go-museum/museum/diagnostic/errors"
+)
+
+// Metrics collects measurements of the delivery pipeline, implementations must be safe for concurrent use
+type Metrics interface {
+	// Enqueued counts the events added to the buffer
+	Enqueued(n int)
+
+	// Dropped counts the events dropped for the reason
+	Dropped(reason DropReason, n int)
+
+	// Flushed counts the events uploaded
+	Flushed(n int)
+
+	// Buffered sets the number of events waiting in the buffer
+	Buffered(n int)
+
+	// Batch observes the number of events of an upload
+	Batch(size int)
+
+	// Request observes a request to the endpoint, the status code is 0 if no response was received
+	Request(endpoint string, code int, latency time.Duration)
+}
+
+// NopMetrics discards every measurement, it is the default collector
+var NopMetrics Metrics = nopMetrics{}
+
+// nopMetrics is a collector discarding every measurement
+type nopMetrics struct{}
+
+func (nopMetrics) Enqueued(int)                       {}
+func (nopMetrics) Dropped(DropReason, int)            {}
+func (nopMetrics) Flushed(int)                        {}
+func (nopMetrics) Buffered(int)                       {}
+func (nopMetrics) Batch(int)                          {}
+func (nopMetrics) Request(string, int, time.Duration) {}
+
+// ExpvarMetrics publishes the measurements as expvar variables
+type ExpvarMetrics struct {
+	vars *expvar.Map
+
+	enqueued     expvar.Int
+	dropped      expvar.Map
+	flushed      expvar.Int
+	buffered     expvar.Int
+	batches      expvar.Int
+	batchEvents  expvar.Int
+	requests     expvar.Map
+	responses    expvar.Map
+	latency      expvar.Map
+	latencyTotal expvar.Float
+}
+
+// expvarMetrics are the collectors published by name, so clients using the same name share one
+var expvarMetrics = struct {
+	sync.Mutex
+	byName map[string]*ExpvarMetrics
+}{byName: make(map[string]*ExpvarMetrics)}
+
+// NewExpvarMetrics creates a collector published under the name (e.g. "amplitude"),
+// latencies are reported as the total seconds spent per endpoint.
+// The collector already published under the name is reused, an error is returned
+// if the name is taken by another expvar variable.
+func NewExpvarMetrics(name string) (*ExpvarMetrics, error) {
+	if name == "" {
+		return newExpvarMetrics(), nil
+	}
+
+	expvarMetrics.Lock()
+	defer expvarMetrics.Unlock()
+
+	if m, ok := expvarMetrics.byName[name]; ok {
+		return m, nil
+	}
+
+	if expvar.Get(name) != nil {
+		return nil, errors.Newf("amplitude: expvar %s is already published", name)
+	}
+
+	m := newExpvarMetrics()
+	expvar.Publish(name, m.vars)
+	expvarMetrics.byName[name] = m
+	return m, nil
+}
+
+// newExpvarMetrics creates an unpublished collector
+func newExpvarMetrics() *ExpvarMetrics {
+	m := ExpvarMetrics{vars: new(expvar.Map).Init()}
+	m.dropped.Init()
+	m.requests.Init()
+	m.responses.Init()
+	m.latency.Init()
+
+	m.vars.Set("events_enqueued", &m.enqueued)
+	m.vars.Set("events_dropped", &m.dropped)
+	m.vars.Set("events_flushed", &m.flushed)
+	m.vars.Set("events_buffered", &m.buffered)
+	m.vars.Set("batches", &m.batches)
+	m.vars.Set("batch_events", &m.batchEvents)
+	m.vars.Set("requests", &m.requests)
+	m.vars.Set("responses", &m.responses)
+	m.vars.Set("request_seconds", &m.latency)
+	m.vars.Set("request_seconds_total", &m.latencyTotal)
+
+	return &m
+}
+
+// Map gets the variables of the collector, to publish or inspect them
+func (m *ExpvarMetrics) Map() *expvar.Map {
+	return m.vars
+}
+
+// Enqueued implements the Metrics interface
+func (m *ExpvarMetrics) Enqueued(n int) {
+	m.enqueued.Add(int64(n))
+}
+
+// Dropped implements the Metrics interface
+func (m *ExpvarMetrics) Dropped(reason DropReason, n int) {
+	m.dropped.Add(string(reason), int64(n))
+}
+
+// Flushed implements the Metrics interface
+func (m *ExpvarMetrics) Flushed(n int) {
+	m.flushed.Add(int64(n))
+}
+
+// Buffered implements the Metrics interface
+func (m *ExpvarMetrics) Buffered(n int) {
+	m.buffered.Set(int64(n))
+}
+
+// Batch implements the Metrics interface
+func (m *ExpvarMetrics) Batch(size int) {
+	m.batches.Add(1)
+	m.batchEvents.Add(int64(size))
+}
+
+// Request implements the Metrics interface
+func (m *ExpvarMetrics) Request(endpoint string, code int, latency time.Duration) {
+	m.requests.Add(endpoint, 1)
+	m.responses.Add(strconv.Itoa(code), 1)
+	m.latency.AddFloat(endpoint, latency.Seconds())
+	m.latencyTotal.Add(latency.Seconds())
+}
+
+// endpoint gets the path of the request measured
+func endpoint(req *http.Request) string {
+	if req.URL == nil {
+		return ""
+	}
+
+	return req.URL.Path
+}
+
+// WithMetrics sets the collector of the client and of the middleware created from it
+func (c *Client) WithMetrics(mc Metrics) *Client {
+	if mc == nil {
+		mc = NopMetrics
+	}
+
+	c.metrics = mc
+	return c
+}
+
+// Metrics sets the collector of the middleware, which defaults to the collector of its client
+func (m *SendMiddleware) Metrics(mc Metrics) *SendMiddleware {
+	m.metrics = mc
+	return m
+}
+
+// measure gets the collector of the middleware
+func (m *SendMiddleware) measure() Metrics {
+	if m.metrics != nil {
+		return m.metrics
+	}
+
+	return m.client.metrics
+}
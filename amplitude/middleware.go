@@ -2,11 +2,11 @@ package amplitude
 
 import (
 	"fmt"
+	"math/rand"
+	"net"
 	"net/http"
+	"sync"
 	"time"
-
-	"github.com/mssola/user_agent"
-	"github.com/pghq/go-museum/museum/diagnostic/errors"
 )
 
 const (
@@ -28,9 +28,30 @@ type SendMiddleware struct {
 	environment  string
 	userHeader   string
 	deviceHeader string
+	rules        []Rule
+	privacy      *PrivacyPolicy
+	trusted      []*net.IPNet
+	anonymize    bool
+	uaParser     UserAgentParser
+	dropBots     bool
+	geo          GeoLocator
+	plan         *TrackingPlan
+	planMode     PlanMode
+	limiter      *RateLimiter
+	workers      int
+	batchSize    int
+	onError      func(err error)
+	onDropped    func(event *Event, reason DropReason, err error)
+	onFlushed    func(summary *BatchEventsSuccessSummary, events []*Event)
+	logger       Logger
+	metrics      Metrics
+	random       func() float64
 	events       chan *Event
 	errors       chan error
 	client       *Client
+
+	lock    sync.Mutex
+	pending []*Event
 }
 
 // Environment sets the environment the app is running
@@ -57,6 +78,25 @@ func (m *SendMiddleware) Version(v string) *SendMiddleware {
 	return m
 }
 
+// IdentityHeaders gets the headers the user and device ids are read from
+func (m *SendMiddleware) IdentityHeaders() (user, device string) {
+	return m.userHeader, m.deviceHeader
+}
+
+// Enrich locates the event from its IP, masking the IP afterwards if anonymizing,
+// and sets the environment and app version as is done for the events of http requests
+func (m *SendMiddleware) Enrich(event *Event) *Event {
+	if err := event.Locate(m.geo); err != nil {
+		m.SendError(err)
+	}
+
+	if m.anonymize {
+		event.IP = MaskIP(event.IP)
+	}
+
+	return event.Environment(m.environment).Version(m.version)
+}
+
 // Error gets any errors that have occurred
 func (m *SendMiddleware) Error() error {
 	select {
@@ -77,8 +117,13 @@ func (m *SendMiddleware) Event() *Event {
 	}
 }
 
-// SendError buffers an error
+// SendError buffers an error, or passes it to the error hook
 func (m *SendMiddleware) SendError(err error) *SendMiddleware {
+	if m.onError != nil {
+		m.onError(err)
+		return m
+	}
+
 	select {
 	case m.errors <- err:
 	default:
@@ -89,12 +134,29 @@ func (m *SendMiddleware) SendError(err error) *SendMiddleware {
 
 // Send buffers an event
 func (m *SendMiddleware) Send(event *Event) *SendMiddleware {
+	m.policy().mask(event)
+
+	if m.plan != nil {
+		if err := m.plan.Check(event); err != nil {
+			if m.planMode != PlanDrop {
+				m.SendError(err)
+			}
+
+			if m.planMode != PlanWarn {
+				m.drop(DropTrackingPlan, err, event)
+				return m
+			}
+		}
+	}
+
 	select {
 	case m.events <- event:
+		m.measure().Enqueued(1)
+		m.measure().Buffered(len(m.events))
 	default:
-		err := errors.Newf("amplitude: event=%s, user=%s, device=%s was dropped",
-			event.Name, event.UserId, event.DeviceId)
+		err := droppedError(event)
 		m.SendError(err)
+		m.drop(DropBufferFull, err, event)
 	}
 
 	return m
@@ -106,27 +168,45 @@ func (m *SendMiddleware) Handle(next http.Handler) http.Handler {
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId, deviceId := r.Header.Get(m.userHeader), r.Header.Get(m.deviceHeader)
+		if userId != "" || deviceId != "" {
+			r = r.WithContext(WithIdentity(r.Context(), userId, deviceId))
+		}
+
 		start := time.Now()
-		next.ServeHTTP(w, r)
-		if r.Header.Get(m.userHeader) == "" && r.Header.Get(m.deviceHeader) == "" {
+		rw := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+		latency := time.Now().Sub(start).Milliseconds()
+		if userId == "" && deviceId == "" {
 			return
 		}
 
-		event := NewEventFromRequest(r, r.Header.Get(m.userHeader), r.Header.Get(m.deviceHeader)).
-			Latency(time.Now().Sub(start).Milliseconds()).
-			Environment(m.environment).
-			Version(m.version)
+		rate, ok := m.sample(r, rw.Status())
+		if !ok {
+			return
+		}
+
+		ua := m.uaParser.Parse(r.UserAgent())
+		if ua.Bot && m.dropBots {
+			return
+		}
 
-		m.Send(event)
+		event := newEventFromRequest(r, ClientIP(r, m.trusted...), userId, deviceId, ua, m.policy())
+		m.Send(m.Enrich(event).
+			Latency(latency).
+			Status(rw.Status()).
+			SampleRate(rate))
 	})
 }
 
 // NewSendMiddleware create a new instance of the amplitude middleware
 func NewSendMiddleware(c *Client) *SendMiddleware {
 	m := SendMiddleware{
-		events: make(chan *Event, MaxEvents),
-		errors: make(chan error, MaxErrors),
-		client: c,
+		events:   make(chan *Event, MaxEvents),
+		errors:   make(chan error, MaxErrors),
+		client:   c,
+		random:   rand.Float64,
+		uaParser: DefaultUserAgentParser,
 	}
 
 	return &m
@@ -139,6 +219,22 @@ func (e *Event) Latency(latency int64) *Event {
 	return e
 }
 
+// Status sets the response status code of the event
+func (e *Event) Status(code int) *Event {
+	e.Properties["status"] = code
+
+	return e
+}
+
+// SampleRate sets the rate the event was sampled at so counts can be re-weighted
+func (e *Event) SampleRate(rate float64) *Event {
+	if rate > 0 && rate < 1 {
+		e.Properties["sample_rate"] = rate
+	}
+
+	return e
+}
+
 // Environment sets the environment of the event
 func (e *Event) Environment(env string) *Event {
 	if env != "" {
@@ -155,26 +251,28 @@ func (e *Event) Version(v string) *Event {
 	return e
 }
 
-// NewEventFromRequest creates a new amplitude event from a http request
+// NewEventFromRequest creates a new amplitude event from a http request,
+// query parameters are captured following the DefaultPrivacyPolicy
 func NewEventFromRequest(r *http.Request, userId, deviceId string) *Event {
+	return newEventFromRequest(r, ClientIP(r), userId, deviceId, DefaultUserAgentParser.Parse(r.UserAgent()), &DefaultPrivacyPolicy)
+}
+
+// newEventFromRequest creates a new amplitude event from a http request, its client address and parsed user agent,
+// capturing the request values allowed by the privacy policy
+func newEventFromRequest(r *http.Request, ip, userId, deviceId string, ua UserAgent, policy *PrivacyPolicy) *Event {
 	event := Event{
 		UserId:     userId,
 		DeviceId:   deviceId,
 		Name:       fmt.Sprintf("%s %s", r.Method, r.URL.Path),
-		IP:         r.Header.Get("X-Forwarded-For"),
+		IP:         ip,
 		Language:   r.Header.Get("Accept-Language"),
 		Time:       time.Now().UnixMilli(),
 		Properties: make(map[string]interface{}),
 	}
 
-	ua := user_agent.New(r.UserAgent())
-	event.OSName, event.OSVersion = ua.Browser()
-	event.DeviceManufacturer, event.DeviceModel = ua.Engine()
-	event.Platform = ua.Platform()
-
-	for k, v := range r.URL.Query() {
-		event.Properties[k] = v
-	}
+	ua.apply(&event)
+	event.Trace(r.Context())
+	policy.capture(&event, r)
 
 	return &event
 }
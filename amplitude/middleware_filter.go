@@ -0,0 +1,194 @@
+package amplitude
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/pghq/go-museum/museum/diagnostic/errors"
+)
+
+// Rule decides whether requests passing through the middleware are tracked.
+// All of the non-empty conditions must match for the rule to apply.
+type Rule struct {
+	// Prefix matches request paths beginning with the value
+	Prefix string
+
+	// Glob matches request paths using path.Match syntax
+	Glob string
+
+	// Regexp matches request paths against the expression
+	Regexp *regexp.Regexp
+
+	// Methods matches any of the listed http methods
+	Methods []string
+
+	// MinStatus and MaxStatus match an inclusive range of response codes
+	MinStatus int
+	MaxStatus int
+
+	// Exclude drops matching requests instead of tracking them
+	Exclude bool
+
+	// SampleRate is the fraction (0, 1] of matching requests to track,
+	// an unset rate tracks every request
+	SampleRate float64
+}
+
+// Match checks if the rule applies to the request and response status
+func (r Rule) Match(req *http.Request, status int) bool {
+	p := req.URL.Path
+	if r.Prefix != "" && !strings.HasPrefix(p, r.Prefix) {
+		return false
+	}
+
+	if r.Glob != "" {
+		if ok, _ := path.Match(r.Glob, p); !ok {
+			return false
+		}
+	}
+
+	if r.Regexp != nil && !r.Regexp.MatchString(p) {
+		return false
+	}
+
+	if len(r.Methods) > 0 {
+		var found bool
+		for _, method := range r.Methods {
+			if strings.EqualFold(method, req.Method) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	if r.MinStatus != 0 && status < r.MinStatus {
+		return false
+	}
+
+	if r.MaxStatus != 0 && status > r.MaxStatus {
+		return false
+	}
+
+	return true
+}
+
+// rate gets the effective sample rate of the rule
+func (r Rule) rate() float64 {
+	if r.SampleRate <= 0 || r.SampleRate > 1 {
+		return 1
+	}
+
+	return r.SampleRate
+}
+
+// Rules sets the rules used to filter and sample requests.
+// Rules are checked in order and the first match wins,
+// requests matching no rule are always tracked.
+func (m *SendMiddleware) Rules(rules ...Rule) *SendMiddleware {
+	m.rules = rules
+	return m
+}
+
+// sample checks the rules for the request and returns the sample rate
+// the event was tracked at, or false if it should be dropped
+func (m *SendMiddleware) sample(r *http.Request, status int) (float64, bool) {
+	for _, rule := range m.rules {
+		if !rule.Match(r, status) {
+			continue
+		}
+
+		if rule.Exclude {
+			return 0, false
+		}
+
+		rate := rule.rate()
+		if rate < 1 && m.random() >= rate {
+			return rate, false
+		}
+
+		return rate, true
+	}
+
+	return 1, true
+}
+
+// statusRecorder captures the status code written by the next handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status code before writing it
+func (w *statusRecorder) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write defaults the status code as the underlying writer would
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush passes flushes through to the underlying writer if supported
+func (w *statusRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack passes hijacking through to the underlying writer (e.g. for websocket upgrades)
+func (w *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("amplitude: response writer does not support hijacking")
+	}
+
+	if w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+
+	return hj.Hijack()
+}
+
+// ReadFrom passes copies through to the underlying writer so it can use sendfile if supported
+func (w *statusRecorder) ReadFrom(r io.Reader) (int64, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		return rf.ReadFrom(r)
+	}
+
+	return io.Copy(struct{ io.Writer }{w.ResponseWriter}, r)
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Status gets the recorded status code
+func (w *statusRecorder) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+
+	return w.status
+}
@@ -2,40 +2,183 @@ package amplitude
 
 import (
 	"context"
+	"hash/fnv"
+	"sync"
 
 	"github.com/pghq/go-museum/museum/diagnostic/errors"
-	"github.com/pghq/go-museum/museum/diagnostic/log"
 )
 
-// Flush will send all batched events to the amplitude batch upload API
+// Workers sets the number of uploads sent at once when flushing,
+// events of a user or device are always uploaded by the same worker so they are delivered in order
+func (m *SendMiddleware) Workers(n int) *SendMiddleware {
+	if n > 0 {
+		m.workers = n
+	}
+
+	return m
+}
+
+// BatchSize sets the max number of events per upload, the size is unlimited if not positive
+func (m *SendMiddleware) BatchSize(n int) *SendMiddleware {
+	m.batchSize = n
+	return m
+}
+
+// Flush will send all batched events to the amplitude batch upload API,
+// events exceeding the rate limits are kept until a later flush.
+// Events are taken from the buffer as workers become available,
+// so the buffer fills up while every worker is busy uploading.
 func (m *SendMiddleware) Flush(ctx context.Context) {
-	var events []*Event
+	workers := m.workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	var wg sync.WaitGroup
+	shards := make([]chan []*Event, workers)
+	for i := range shards {
+		shards[i] = make(chan []*Event)
+		wg.Add(1)
+		go func(shard <-chan []*Event) {
+			defer wg.Done()
+			for events := range shard {
+				m.upload(ctx, events)
+			}
+		}(shards[i])
+	}
+
+	defer func() {
+		for _, shard := range shards {
+			close(shard)
+		}
+		wg.Wait()
+	}()
+
 	for {
-		select {
-		case <-ctx.Done():
-			m.SendError(errors.Wrap(ctx.Err()))
+		events, more, err := m.drain(ctx, workers*m.batchSize)
+		if err != nil {
+			m.SendError(errors.Wrap(err))
+			m.drop(DropCancelled, err, events...)
 			return
-		default:
-			event := m.Event()
-			if event != nil {
-				events = append(events, event)
+		}
+
+		events = m.limit(events)
+		batches := make([][]*Event, workers)
+		for _, event := range events {
+			i := shard(event, workers)
+			batches[i] = append(batches[i], event)
+		}
+
+		for i, batch := range batches {
+			if len(batch) == 0 {
 				continue
 			}
 
-			if len(events) == 0 {
+			// waits for the worker to finish its previous upload, leaving the following events buffered
+			select {
+			case shards[i] <- batch:
+			case <-ctx.Done():
+				m.SendError(errors.Wrap(ctx.Err()))
+				for _, batch := range batches[i:] {
+					m.drop(DropCancelled, ctx.Err(), batch...)
+				}
 				return
 			}
+		}
+
+		if !more {
+			return
+		}
+	}
+}
+
+// drain takes the events from the buffer, up to max events if positive,
+// more is set if it stopped before the buffer was empty.
+// The events taken are returned along with the error of a cancelled context.
+func (m *SendMiddleware) drain(ctx context.Context, max int) (events []*Event, more bool, err error) {
+	for max <= 0 || len(events) < max {
+		select {
+		case <-ctx.Done():
+			return events, false, ctx.Err()
+		default:
+		}
+
+		event := m.Event()
+		if event == nil {
+			m.measure().Buffered(len(m.events))
+			return events, false, nil
+		}
+
+		events = append(events, event)
+	}
+
+	m.measure().Buffered(len(m.events))
+	return events, true, nil
+}
 
-			resp, err := m.client.Events.Send(ctx, events...)
-			if err != nil {
+// upload sends the events in batches of the max batch size
+func (m *SendMiddleware) upload(ctx context.Context, events []*Event) {
+	for len(events) > 0 {
+		batch := events
+		if m.batchSize > 0 && len(batch) > m.batchSize {
+			batch = events[:m.batchSize]
+		}
+		events = events[len(batch):]
+
+		resp, uploaded, err := m.client.Events.send(ctx, batch)
+		if len(uploaded) > 0 {
+			m.measure().Batch(len(uploaded))
+		}
+
+		if resp == nil {
+			m.SendError(errors.Wrap(err))
+			m.drop(DropUploadFailed, err, batch...)
+			continue
+		}
+
+		// events are validated after the plugins, which may complete or invalidate them
+		for _, verr := range resp.Invalid {
+			m.SendError(verr)
+			m.drop(DropInvalid, verr, verr.Event)
+		}
+
+		for _, violation := range resp.Blocked {
+			m.SendError(violation)
+			m.drop(DropTrackingPlan, violation, violation.Event)
+		}
+
+		if err != nil {
+			if len(uploaded) > 0 {
 				m.SendError(errors.Wrap(err))
-				return
+				m.drop(DropUploadFailed, err, uploaded...)
 			}
+			continue
+		}
 
-			log.Infof("amplitude: total=%d, size=%d, time=%d events were flushed",
-				resp.EventsIngested, resp.PayloadSize, resp.UploadTime)
-
-			return
+		// events dropped by the plugins, the tracking plan or as duplicates were not uploaded
+		if len(uploaded) == 0 {
+			continue
 		}
+
+		m.measure().Flushed(len(uploaded))
+		m.flushed(resp, uploaded)
+		m.log().Log(ctx, LogInfo, "amplitude: events were flushed",
+			"total", resp.EventsIngested, "size", resp.PayloadSize, "time", resp.UploadTime)
+	}
+}
+
+// shard picks the worker uploading the events of the user, or the device of anonymous events
+func shard(event *Event, workers int) int {
+	if workers <= 1 {
+		return 0
 	}
+
+	id := event.UserId
+	if id == "" {
+		id = event.DeviceId
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(id))
+	return int(h.Sum32() % uint32(workers))
 }
@@ -0,0 +1,73 @@
+package amplitude
+
+import (
+	"github.com/pghq/go-museum/museum/diagnostic/errors"
+)
+
+// DropReason is why the middleware dropped an event
+type DropReason string
+
+const (
+	// DropBufferFull is an event sent while the buffer was full
+	DropBufferFull DropReason = "buffer_full"
+
+	// DropInvalid is an event Amplitude would reject
+	DropInvalid DropReason = "invalid"
+
+	// DropTrackingPlan is an event violating the tracking plan
+	DropTrackingPlan DropReason = "tracking_plan"
+
+	// DropRateLimited is an event held back by the rate limiter while its buffer was full
+	DropRateLimited DropReason = "rate_limited"
+
+	// DropUploadFailed is an event whose upload failed
+	DropUploadFailed DropReason = "upload_failed"
+
+	// DropCancelled is an event taken from the buffer by a flush cancelled before uploading it
+	DropCancelled DropReason = "cancelled"
+)
+
+// OnError sets the hook called with every error, errors are no longer buffered for Error once it is set.
+// Hooks may be called concurrently while flushing.
+func (m *SendMiddleware) OnError(fn func(err error)) *SendMiddleware {
+	m.onError = fn
+	return m
+}
+
+// OnDropped sets the hook called with every event dropped, the reason and the error that caused it if any
+func (m *SendMiddleware) OnDropped(fn func(event *Event, reason DropReason, err error)) *SendMiddleware {
+	m.onDropped = fn
+	return m
+}
+
+// OnFlushed sets the hook called with the summary of each upload and the events it sent,
+// which are the events of the batch remaining after the client plugins, validation, tracking plan and deduplication
+func (m *SendMiddleware) OnFlushed(fn func(summary *BatchEventsSuccessSummary, events []*Event)) *SendMiddleware {
+	m.onFlushed = fn
+	return m
+}
+
+// drop reports that events were dropped
+func (m *SendMiddleware) drop(reason DropReason, err error, events ...*Event) {
+	m.measure().Dropped(reason, len(events))
+	if m.onDropped == nil {
+		return
+	}
+
+	for _, event := range events {
+		m.onDropped(event, reason, err)
+	}
+}
+
+// flushed reports a successful upload
+func (m *SendMiddleware) flushed(summary *BatchEventsSuccessSummary, events []*Event) {
+	if m.onFlushed != nil {
+		m.onFlushed(summary, events)
+	}
+}
+
+// droppedError creates the error of an event dropped for lack of space
+func droppedError(event *Event) error {
+	return errors.Newf("amplitude: event=%s, user=%s, device=%s was dropped",
+		event.Name, event.UserId, event.DeviceId)
+}
@@ -0,0 +1,141 @@
+package amplitude
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pghq/go-museum/museum/diagnostic/errors"
+)
+
+// TrustedProxies sets the proxy addresses or CIDR ranges allowed to
+// report the client address through the Forwarded and X-Forwarded-For headers,
+// the proxies are left unchanged if any of them is invalid
+func (m *SendMiddleware) TrustedProxies(cidrs ...string) (*SendMiddleware, error) {
+	var trusted []*net.IPNet
+	for _, cidr := range cidrs {
+		n, err := ParseCIDR(cidr)
+		if err != nil {
+			return m, err
+		}
+
+		trusted = append(trusted, n)
+	}
+
+	m.trusted = trusted
+	return m, nil
+}
+
+// AnonymizeIP zeroes the host portion of client addresses before events are sent
+func (m *SendMiddleware) AnonymizeIP(enabled bool) *SendMiddleware {
+	m.anonymize = enabled
+	return m
+}
+
+// ParseCIDR parses a CIDR range or a single address as a network
+func ParseCIDR(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, errors.Newf("amplitude: invalid proxy address %s", s)
+		}
+
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	return n, nil
+}
+
+// ClientIP resolves the address of the client that made the request.
+// The proxy chain is walked from the nearest hop while the hop is trusted,
+// so with no trusted proxies the remote address of the connection is used.
+func ClientIP(r *http.Request, trusted ...*net.IPNet) string {
+	ip := parseHop(r.RemoteAddr)
+	if ip == nil {
+		return ""
+	}
+
+	chain := forwardedFor(r)
+	for i := len(chain) - 1; i >= 0 && isTrusted(ip, trusted); i-- {
+		hop := parseHop(chain[i])
+		if hop == nil {
+			break
+		}
+
+		ip = hop
+	}
+
+	return ip.String()
+}
+
+// MaskIP anonymizes an address by zeroing the last octet of IPv4
+// addresses and everything after the /48 prefix of IPv6 addresses
+func MaskIP(s string) string {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return ""
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(24, 8*net.IPv4len)).String()
+	}
+
+	return ip.Mask(net.CIDRMask(48, 8*net.IPv6len)).String()
+}
+
+// forwardedFor lists the proxy chain of the request, preferring RFC 7239 Forwarded
+func forwardedFor(r *http.Request) []string {
+	var chain []string
+	for _, header := range r.Header.Values("Forwarded") {
+		for _, element := range strings.Split(header, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+				if len(kv) == 2 && strings.EqualFold(kv[0], "for") {
+					chain = append(chain, strings.Trim(kv[1], `"`))
+				}
+			}
+		}
+	}
+
+	if len(chain) > 0 {
+		return chain
+	}
+
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			chain = append(chain, strings.TrimSpace(hop))
+		}
+	}
+
+	return chain
+}
+
+// parseHop parses an address which may include a port or IPv6 brackets
+func parseHop(s string) net.IP {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+
+	return net.ParseIP(strings.Trim(s, "[]"))
+}
+
+// isTrusted checks if the address belongs to a trusted proxy
+func isTrusted(ip net.IP, trusted []*net.IPNet) bool {
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
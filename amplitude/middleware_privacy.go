@@ -0,0 +1,185 @@
+package amplitude
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces values removed by privacy controls
+const Redacted = "[REDACTED]"
+
+// Detector masks sensitive content found within a value
+type Detector func(v string) string
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	jwtPattern   = regexp.MustCompile(`eyJ[A-Za-z0-9_\-]+\.eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]*`)
+	cardPattern  = regexp.MustCompile(`\b\d(?:[ \-]?\d){12,18}\b`)
+)
+
+// DetectEmail masks email addresses
+func DetectEmail(v string) string {
+	return emailPattern.ReplaceAllString(v, Redacted)
+}
+
+// DetectJWT masks JSON web tokens
+func DetectJWT(v string) string {
+	return jwtPattern.ReplaceAllString(v, Redacted)
+}
+
+// DetectCardNumber masks payment card numbers passing the Luhn checksum
+func DetectCardNumber(v string) string {
+	return cardPattern.ReplaceAllStringFunc(v, func(s string) string {
+		if !luhn(s) {
+			return s
+		}
+
+		return Redacted
+	})
+}
+
+// DefaultDetectors are the built-in detectors for common secrets and PII
+var DefaultDetectors = []Detector{DetectJWT, DetectEmail, DetectCardNumber}
+
+// PrivacyPolicy controls which request values are captured by the middleware
+type PrivacyPolicy struct {
+	// AllowQuery captures only the listed query parameters when set
+	AllowQuery []string
+
+	// DenyQuery never captures the listed query parameters
+	DenyQuery []string
+
+	// RedactQuery captures the listed query parameters with masked values
+	RedactQuery []string
+
+	// Headers captures the listed request headers as "header.<name>" properties
+	Headers []string
+
+	// Detectors mask sensitive content in the query parameters and headers captured from requests
+	Detectors []Detector
+
+	// MaskProperties also runs the detectors over the properties and user properties of every event sent
+	MaskProperties bool
+}
+
+// DefaultPrivacyPolicy is used when no policy is set, it never captures common credential
+// query parameters and masks emails and tokens in the values captured.
+// Card numbers are not detected by default as ids and timestamps may pass the checksum.
+var DefaultPrivacyPolicy = PrivacyPolicy{
+	DenyQuery: []string{"access_token", "api_key", "password", "secret", "token"},
+	Detectors: []Detector{DetectJWT, DetectEmail},
+}
+
+// Privacy sets the policy used to capture request values, replacing the default policy
+func (m *SendMiddleware) Privacy(p PrivacyPolicy) *SendMiddleware {
+	m.privacy = &p
+	return m
+}
+
+// policy gets the privacy policy of the middleware
+func (m *SendMiddleware) policy() *PrivacyPolicy {
+	if m.privacy != nil {
+		return m.privacy
+	}
+
+	return &DefaultPrivacyPolicy
+}
+
+// capture sets the query parameters and headers of the request allowed by the policy as properties of the event
+func (p *PrivacyPolicy) capture(event *Event, r *http.Request) {
+	for k, values := range r.URL.Query() {
+		switch {
+		case contains(p.DenyQuery, k):
+		case len(p.AllowQuery) > 0 && !contains(p.AllowQuery, k):
+		case contains(p.RedactQuery, k):
+			masked := make([]string, len(values))
+			for i := range masked {
+				masked[i] = Redacted
+			}
+			event.Properties[k] = masked
+		default:
+			event.Properties[k] = p.maskValue(values)
+		}
+	}
+
+	for _, h := range p.Headers {
+		if v := r.Header.Get(h); v != "" {
+			event.Properties["header."+strings.ToLower(h)] = p.maskValue(v)
+		}
+	}
+}
+
+// mask runs the detectors over all string values of the event properties if the policy masks properties,
+// collections are copied first so values shared with the caller are left untouched
+func (p *PrivacyPolicy) mask(event *Event) {
+	if !p.MaskProperties || len(p.Detectors) == 0 {
+		return
+	}
+
+	for _, props := range []map[string]interface{}{event.Properties, event.UserProperties} {
+		for k, v := range props {
+			props[k] = p.maskValue(cloneValue(v))
+		}
+	}
+}
+
+// maskValue masks a single property value, descending into collections
+func (p *PrivacyPolicy) maskValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		for _, detect := range p.Detectors {
+			v = detect(v)
+		}
+		return v
+	case []string:
+		for i, s := range v {
+			v[i] = p.maskValue(s).(string)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = p.maskValue(e)
+		}
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = p.maskValue(e)
+		}
+	}
+
+	return v
+}
+
+// contains checks if the key is listed (case-insensitive)
+func contains(list []string, key string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// luhn validates a number using the Luhn checksum
+func luhn(s string) bool {
+	var sum, n int
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+
+		sum += d
+		n++
+	}
+
+	return n > 0 && sum%10 == 0
+}
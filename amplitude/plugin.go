@@ -0,0 +1,132 @@
+package amplitude
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Plugin processes each event before it is sent. The returned events
+// continue through the pipeline: the event itself (possibly mutated),
+// none to drop it, or several to fan it out.
+type Plugin interface {
+	Execute(ctx context.Context, event *Event) ([]*Event, error)
+}
+
+// PluginFunc adapts a function to the Plugin interface
+type PluginFunc func(ctx context.Context, event *Event) ([]*Event, error)
+
+// Execute calls the function
+func (f PluginFunc) Execute(ctx context.Context, event *Event) ([]*Event, error) {
+	return f(ctx, event)
+}
+
+// Destination receives the batches of events uploaded by the client
+// in addition to the Amplitude batch upload API
+type Destination interface {
+	Deliver(ctx context.Context, events []*Event) error
+}
+
+// DestinationFunc adapts a function to the Destination interface
+type DestinationFunc func(ctx context.Context, events []*Event) error
+
+// Deliver calls the function
+func (f DestinationFunc) Deliver(ctx context.Context, events []*Event) error {
+	return f(ctx, events)
+}
+
+// DestinationError reports destinations which failed to receive a batch
+type DestinationError struct {
+	Errors []error
+}
+
+// Error implements the error interface
+func (e *DestinationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+
+	return fmt.Sprintf("amplitude: %d destinations failed: %s", len(e.Errors), strings.Join(messages, "; "))
+}
+
+// PluginError reports a plugin which failed to process an event, the event is dropped
+type PluginError struct {
+	Event *Event
+	Err   error
+}
+
+// Error implements the error interface
+func (e *PluginError) Error() string {
+	return fmt.Sprintf("amplitude: plugin failed on event=%s, user=%s, device=%s: %s",
+		e.Event.Name, e.Event.UserId, e.Event.DeviceId, e.Err)
+}
+
+// Unwrap gets the error of the plugin
+func (e *PluginError) Unwrap() error {
+	return e.Err
+}
+
+// Use registers plugins to run in order for every event sent by the client
+func (c *Client) Use(plugins ...Plugin) *Client {
+	c.plugins = append(c.plugins, plugins...)
+	return c
+}
+
+// WithDestination registers destinations receiving every batch sent by the client
+func (c *Client) WithDestination(destinations ...Destination) *Client {
+	c.destinations = append(c.destinations, destinations...)
+	return c
+}
+
+// OnError sets the hook called with the errors of plugins, destinations and the tracking plan in warn mode,
+// which only affect the event or destination they are about rather than the upload, they are logged by default
+func (c *Client) OnError(fn func(ctx context.Context, err error)) *Client {
+	c.onError = fn
+	return c
+}
+
+// report passes an error which does not fail the upload to the error hook, or logs it at the level.
+// The error is logged under a prefixed key so it does not collide with the attributes a slog handler matches on.
+func (c *Client) report(ctx context.Context, level LogLevel, msg string, err error) {
+	if c.onError != nil {
+		c.onError(ctx, err)
+		return
+	}
+
+	c.logger.Log(ctx, level, msg, "amplitude.error", err.Error())
+}
+
+// execute runs the events through the registered plugins, events a plugin fails on are dropped and reported
+func (c *Client) execute(ctx context.Context, events []*Event) []*Event {
+	for _, plugin := range c.plugins {
+		var next []*Event
+		for _, event := range events {
+			out, err := plugin.Execute(ctx, event)
+			if err != nil {
+				c.report(ctx, LogError, "amplitude: plugin failed", &PluginError{Event: event, Err: err})
+				continue
+			}
+
+			next = append(next, out...)
+		}
+
+		events = next
+	}
+
+	return events
+}
+
+// deliver sends the uploaded batch to the registered destinations, reporting those which failed
+func (c *Client) deliver(ctx context.Context, events []*Event) {
+	var errs []error
+	for _, destination := range c.destinations {
+		if err := destination.Deliver(ctx, events); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		c.report(ctx, LogError, "amplitude: destinations failed", &DestinationError{Errors: errs})
+	}
+}
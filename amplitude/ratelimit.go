@@ -0,0 +1,194 @@
+package amplitude
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// minIdleBuckets is the number of per id buckets kept before idle ones are pruned
+const minIdleBuckets = 1024
+
+// RateLimiter is a token bucket limiting the events sent overall and per user and device
+type RateLimiter struct {
+	rate    float64
+	burst   float64
+	idRate  float64
+	idBurst float64
+	now     func() time.Time
+
+	lock    sync.Mutex
+	global  bucket
+	ids     map[string]*bucket
+	pruneAt int
+}
+
+// bucket holds the tokens available to send events
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a limiter sending events at the rate (per second) with bursts of up to burst events,
+// the overall rate is unlimited if not positive
+func NewRateLimiter(eventsPerSecond float64, burst int) *RateLimiter {
+	l := RateLimiter{
+		rate:    eventsPerSecond,
+		burst:   math.Max(float64(burst), 1),
+		now:     time.Now,
+		ids:     make(map[string]*bucket),
+		pruneAt: minIdleBuckets,
+	}
+
+	return &l
+}
+
+// PerId limits the events of each user and device to the rate (per second) with bursts of up to burst events
+func (l *RateLimiter) PerId(eventsPerSecond float64, burst int) *RateLimiter {
+	l.idRate = eventsPerSecond
+	l.idBurst = math.Max(float64(burst), 1)
+	return l
+}
+
+// Allow takes a token for the event if it may be sent now
+func (l *RateLimiter) Allow(event *Event) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := l.now()
+	var buckets []*bucket
+	if l.rate > 0 {
+		l.global.refill(now, l.rate, l.burst)
+		buckets = append(buckets, &l.global)
+	}
+
+	if l.idRate > 0 {
+		for _, key := range rateKeys(event) {
+			b := l.ids[key]
+			if b == nil {
+				b = &bucket{}
+				l.ids[key] = b
+			}
+
+			b.refill(now, l.idRate, l.idBurst)
+			buckets = append(buckets, b)
+		}
+	}
+
+	for _, b := range buckets {
+		if b.tokens < 1 {
+			return false
+		}
+	}
+
+	for _, b := range buckets {
+		b.tokens--
+	}
+
+	l.prune(now)
+	return true
+}
+
+// prune forgets the buckets of ids which have been idle long enough to be full again
+func (l *RateLimiter) prune(now time.Time) {
+	if len(l.ids) < l.pruneAt {
+		return
+	}
+
+	for key, b := range l.ids {
+		if b.refill(now, l.idRate, l.idBurst); b.tokens >= l.idBurst {
+			delete(l.ids, key)
+		}
+	}
+
+	l.pruneAt = 2 * len(l.ids)
+	if l.pruneAt < minIdleBuckets {
+		l.pruneAt = minIdleBuckets
+	}
+}
+
+// refill adds the tokens earned since the bucket was last used
+func (b *bucket) refill(now time.Time, rate, burst float64) {
+	if b.last.IsZero() {
+		b.tokens = burst
+	} else if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(burst, b.tokens+elapsed*rate)
+	}
+
+	b.last = now
+}
+
+// rateKeys gets the keys of the user and device of the event
+func rateKeys(event *Event) []string {
+	var keys []string
+	if event.UserId != "" {
+		keys = append(keys, "user:"+event.UserId)
+	}
+
+	if event.DeviceId != "" {
+		keys = append(keys, "device:"+event.DeviceId)
+	}
+
+	return keys
+}
+
+// RateLimit sets the limiter smoothing uploads, events exceeding the limits are kept until a later flush
+func (m *SendMiddleware) RateLimit(l *RateLimiter) *SendMiddleware {
+	m.limiter = l
+	return m
+}
+
+// limit holds back the events exceeding the rate limits until a later flush,
+// events of a user or device held back hold back their following events to keep them in order
+func (m *SendMiddleware) limit(events []*Event) []*Event {
+	if m.limiter == nil {
+		return events
+	}
+
+	var allowed, dropped []*Event
+	m.lock.Lock()
+	events = append(m.pending, events...)
+	m.pending = nil
+
+	held := make(map[string]bool)
+	for _, event := range events {
+		keys := rateKeys(event)
+		var blocked bool
+		for _, key := range keys {
+			blocked = blocked || held[key]
+		}
+
+		if blocked || !m.limiter.Allow(event) {
+			for _, key := range keys {
+				held[key] = true
+			}
+
+			if len(m.pending) < MaxEvents {
+				m.pending = append(m.pending, event)
+			} else {
+				dropped = append(dropped, event)
+			}
+			continue
+		}
+
+		allowed = append(allowed, event)
+	}
+	m.lock.Unlock()
+
+	// hooks are called without holding the lock so they may use the middleware
+	for _, event := range dropped {
+		err := droppedError(event)
+		m.SendError(err)
+		m.drop(DropRateLimited, err, event)
+	}
+
+	return allowed
+}
+
+// Pending gets the number of events held back by the rate limiter
+func (m *SendMiddleware) Pending() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return len(m.pending)
+}
@@ -0,0 +1,185 @@
+package amplitude
+
+import (
+	"math"
+	"regexp"
+	"time"
+
+	"github.com/pghq/go-museum/museum/diagnostic/errors"
+)
+
+const (
+	// RevenueEventName is the event type Amplitude uses for revenue
+	RevenueEventName = "revenue_amount"
+
+	// RevenueTypeRefund is the revenue type of negative amounts
+	RevenueTypeRefund = "refund"
+)
+
+// currencyPattern matches ISO 4217 currency codes
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// currencyDecimals lists the minor units of currencies not using two decimals
+var currencyDecimals = map[string]int{
+	"BHD": 3, "BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "IQD": 3, "ISK": 0,
+	"JOD": 3, "JPY": 0, "KMF": 0, "KRW": 0, "KWD": 3, "LYD": 3, "OMR": 3,
+	"PYG": 0, "RWF": 0, "TND": 3, "UGX": 0, "VND": 0, "VUV": 0, "XAF": 0,
+	"XOF": 0, "XPF": 0,
+}
+
+// Revenue builds revenue events following Amplitude's revenue rules
+type Revenue struct {
+	productId   string
+	price       float64
+	quantity    int
+	revenueType string
+	currency    string
+	receipt     string
+	receiptSig  string
+	properties  map[string]interface{}
+}
+
+// NewRevenue creates a revenue of a single item at the price,
+// refunds are recorded with a negative price
+func NewRevenue(price float64) *Revenue {
+	r := Revenue{
+		price:      price,
+		quantity:   1,
+		properties: make(map[string]interface{}),
+	}
+
+	return &r
+}
+
+// ProductId sets the identifier of the product purchased
+func (r *Revenue) ProductId(id string) *Revenue {
+	r.productId = id
+	return r
+}
+
+// Quantity sets the number of items purchased
+func (r *Revenue) Quantity(n int) *Revenue {
+	r.quantity = n
+	return r
+}
+
+// Type sets the revenue type (e.g. purchase, refund)
+func (r *Revenue) Type(t string) *Revenue {
+	r.revenueType = t
+	return r
+}
+
+// Currency sets the ISO 4217 currency code of the price
+func (r *Revenue) Currency(code string) *Revenue {
+	r.currency = code
+	return r
+}
+
+// Receipt sets the receipt and receipt signature used for revenue verification
+func (r *Revenue) Receipt(receipt, signature string) *Revenue {
+	r.receipt = receipt
+	r.receiptSig = signature
+	return r
+}
+
+// Property sets an additional event property
+func (r *Revenue) Property(key string, value interface{}) *Revenue {
+	r.properties[key] = value
+	return r
+}
+
+// Amount gets the total revenue (price times quantity)
+func (r *Revenue) Amount() float64 {
+	return r.price * float64(r.quantity)
+}
+
+// Properties gets the revenue event properties
+func (r *Revenue) Properties() map[string]interface{} {
+	props := make(map[string]interface{}, len(r.properties)+8)
+	for k, v := range r.properties {
+		props[k] = v
+	}
+
+	props["$price"] = r.price
+	props["$quantity"] = r.quantity
+	props["$revenue"] = r.Amount()
+
+	optional := map[string]string{
+		"$productId":   r.productId,
+		"$revenueType": r.revenueType,
+		"$currency":    r.currency,
+		"$receipt":     r.receipt,
+		"$receiptSig":  r.receiptSig,
+	}
+
+	for k, v := range optional {
+		if v != "" {
+			props[k] = v
+		}
+	}
+
+	return props
+}
+
+// Validate checks the revenue against Amplitude's revenue rules
+func (r *Revenue) Validate() error {
+	if math.IsNaN(r.price) || math.IsInf(r.price, 0) {
+		return errors.New("amplitude: revenue price must be a finite number")
+	}
+
+	if r.quantity < 1 {
+		return errors.Newf("amplitude: revenue quantity %d must be at least 1", r.quantity)
+	}
+
+	if r.price < 0 && r.revenueType != RevenueTypeRefund {
+		return errors.Newf("amplitude: negative revenue must have the %s type", RevenueTypeRefund)
+	}
+
+	if r.price > 0 && r.revenueType == RevenueTypeRefund {
+		return errors.New("amplitude: refunds must have a negative price")
+	}
+
+	if r.currency != "" {
+		if !currencyPattern.MatchString(r.currency) {
+			return errors.Newf("amplitude: currency %s is not an ISO 4217 code", r.currency)
+		}
+
+		decimals, ok := currencyDecimals[r.currency]
+		if !ok {
+			decimals = 2
+		}
+
+		scale := math.Pow10(decimals)
+		if units := r.price * scale; math.Abs(units-math.Round(units)) > 1e-6 {
+			return errors.Newf("amplitude: price %v has more than %d decimals for %s", r.price, decimals, r.currency)
+		}
+	}
+
+	if r.receiptSig != "" && r.receipt == "" {
+		return errors.New("amplitude: receipt signature requires a receipt")
+	}
+
+	return nil
+}
+
+// Event creates a validated revenue event for the user or device
+func (r *Revenue) Event(userId, deviceId string) (*Event, error) {
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+
+	event := Event{
+		UserId:      userId,
+		DeviceId:    deviceId,
+		Name:        RevenueEventName,
+		Time:        time.Now().UnixMilli(),
+		Price:       r.price,
+		Quantity:    r.quantity,
+		Revenue:     r.Amount(),
+		ProductId:   r.productId,
+		RevenueType: r.revenueType,
+		Properties:  r.Properties(),
+	}
+
+	return &event, nil
+}
@@ -0,0 +1,224 @@
+package amplitude
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/pghq/go-museum/museum/diagnostic/errors"
+)
+
+// Route maps the events it matches to one or more clients,
+// a route without a match function matches every event
+type Route struct {
+	Match   func(event *Event) bool
+	Clients []*Client
+}
+
+// MatchEnvironment matches events sent from the environment
+func MatchEnvironment(env string) func(event *Event) bool {
+	return MatchProperty("environment", env)
+}
+
+// MatchProperty matches events with the event property set to the value
+func MatchProperty(key string, value interface{}) func(event *Event) bool {
+	return func(event *Event) bool {
+		v, ok := event.Properties[key]
+		return ok && reflect.DeepEqual(v, value)
+	}
+}
+
+// Router fans events out to multiple projects, each client
+// has its own buffer which is flushed independently
+type Router struct {
+	routes   []Route
+	fallback []*Client
+	errors   chan error
+
+	lock    sync.Mutex
+	buffers map[*Client]*SendMiddleware
+	order   []*Client
+}
+
+// NewRouter creates a new instance of the amplitude router
+func NewRouter(routes ...Route) *Router {
+	r := Router{
+		routes:  routes,
+		errors:  make(chan error, MaxErrors),
+		buffers: make(map[*Client]*SendMiddleware),
+	}
+
+	return &r
+}
+
+// Default sets the clients receiving events no route matches
+func (r *Router) Default(clients ...*Client) *Router {
+	r.fallback = clients
+	return r
+}
+
+// Middleware gets the buffer of a client so it can be configured
+func (r *Router) Middleware(c *Client) *SendMiddleware {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	m, ok := r.buffers[c]
+	if !ok {
+		m = c.SendMiddleware()
+		r.buffers[c] = m
+		r.order = append(r.order, c)
+	}
+
+	return m
+}
+
+// Send buffers an event for every client of the matching routes
+func (r *Router) Send(event *Event) *Router {
+	clients := r.clients(event)
+	if len(clients) == 0 {
+		err := errors.Newf("amplitude: event=%s, user=%s, device=%s has no route",
+			event.Name, event.UserId, event.DeviceId)
+		r.SendError(err)
+		return r
+	}
+
+	// copies are made before any buffer may be flushed, so each destination can mutate its event independently
+	events := make([]*Event, len(clients))
+	events[0] = event
+	for i := 1; i < len(clients); i++ {
+		events[i] = event.clone()
+	}
+
+	for i, c := range clients {
+		r.Middleware(c).Send(events[i])
+	}
+
+	return r
+}
+
+// Flush sends the buffered events of every client concurrently,
+// failures are isolated to the buffer of the client that failed
+func (r *Router) Flush(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, m := range r.middleware() {
+		wg.Add(1)
+		go func(m *SendMiddleware) {
+			defer wg.Done()
+			m.Flush(ctx)
+		}(m)
+	}
+
+	wg.Wait()
+}
+
+// SendError buffers an error
+func (r *Router) SendError(err error) *Router {
+	select {
+	case r.errors <- err:
+	default:
+	}
+
+	return r
+}
+
+// Error gets any errors that have occurred while routing or flushing
+func (r *Router) Error() error {
+	select {
+	case err := <-r.errors:
+		return err
+	default:
+	}
+
+	for _, m := range r.middleware() {
+		if err := m.Error(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// clients lists the distinct clients of all routes matching the event
+func (r *Router) clients(event *Event) []*Client {
+	var clients []*Client
+	seen := make(map[*Client]bool)
+	for _, route := range r.routes {
+		if route.Match != nil && !route.Match(event) {
+			continue
+		}
+
+		for _, c := range route.Clients {
+			if !seen[c] {
+				seen[c] = true
+				clients = append(clients, c)
+			}
+		}
+	}
+
+	if len(clients) == 0 {
+		return r.fallback
+	}
+
+	return clients
+}
+
+// middleware lists the buffers in the order the clients were first routed to
+func (r *Router) middleware() []*SendMiddleware {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	buffers := make([]*SendMiddleware, len(r.order))
+	for i, c := range r.order {
+		buffers[i] = r.buffers[c]
+	}
+
+	return buffers
+}
+
+// clone copies the event and deep copies its property maps, including nested maps and slices
+func (e *Event) clone() *Event {
+	c := *e
+	c.Properties = cloneMap(e.Properties)
+	c.UserProperties = cloneMap(e.UserProperties)
+	c.Groups = cloneMap(e.Groups)
+	c.GroupProperties = cloneMap(e.GroupProperties)
+	return &c
+}
+
+// cloneMap deep copies the entries of a map
+func cloneMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		c[k] = cloneValue(v)
+	}
+
+	return c
+}
+
+// cloneValue deep copies the maps and slices of a property value
+func cloneValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return cloneMap(v)
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, item := range v {
+			c[i] = cloneValue(item)
+		}
+		return c
+	case map[string]string:
+		c := make(map[string]string, len(v))
+		for k, item := range v {
+			c[k] = item
+		}
+		return c
+	case []string:
+		return append([]string(nil), v...)
+	}
+
+	return v
+}
@@ -0,0 +1,214 @@
+package amplitude
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// SlogHandler is a slog.Handler forwarding the records matching its predicate to the middleware as events,
+// every record is also passed on to the wrapped handler
+type SlogHandler struct {
+	next      slog.Handler
+	m         *SendMiddleware
+	match     func(r slog.Record) bool
+	level     slog.Leveler
+	nameKey   string
+	userKey   string
+	deviceKey string
+	attrs     []slog.Attr
+	groups    []string
+}
+
+// HasSlogAttr matches records with the attribute
+func HasSlogAttr(key string) func(r slog.Record) bool {
+	return func(r slog.Record) bool {
+		var found bool
+		r.Attrs(func(a slog.Attr) bool {
+			found = a.Key == key
+			return !found
+		})
+
+		return found
+	}
+}
+
+// SlogHandler creates a slog handler sending events to the middleware
+func (m *SendMiddleware) SlogHandler(next slog.Handler) *SlogHandler {
+	return NewSlogHandler(m, next)
+}
+
+// NewSlogHandler creates a slog handler wrapping the next handler, records with an "event" attribute are
+// sent as events named after it, with the "user_id" and "device_id" attributes or the identity of the context
+func NewSlogHandler(m *SendMiddleware, next slog.Handler) *SlogHandler {
+	h := SlogHandler{
+		next:      next,
+		m:         m,
+		match:     HasSlogAttr("event"),
+		level:     slog.LevelInfo,
+		nameKey:   "event",
+		userKey:   "user_id",
+		deviceKey: "device_id",
+	}
+
+	return &h
+}
+
+// Match sets the predicate of the records sent as events,
+// the attributes of the logger are included in the record with their group as prefix (e.g. "request.id")
+func (h *SlogHandler) Match(fn func(r slog.Record) bool) *SlogHandler {
+	h.match = fn
+	return h
+}
+
+// Level sets the minimum level of the records sent as events
+func (h *SlogHandler) Level(l slog.Leveler) *SlogHandler {
+	h.level = l
+	return h
+}
+
+// Name sets the attribute holding the event name, the message is the name of records without it
+func (h *SlogHandler) Name(key string) *SlogHandler {
+	h.nameKey = key
+	return h
+}
+
+// Identity sets the attributes holding the user and device ids
+func (h *SlogHandler) Identity(userKey, deviceKey string) *SlogHandler {
+	h.userKey = userKey
+	h.deviceKey = deviceKey
+	return h
+}
+
+// Enabled implements the slog.Handler interface
+func (h *SlogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level() || h.next.Enabled(ctx, level)
+}
+
+// Handle implements the slog.Handler interface,
+// records logged by this package are only passed on so they never become events
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= h.level.Level() && !internal(ctx) {
+		record := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+		record.AddAttrs(h.attrs...)
+		r.Attrs(func(a slog.Attr) bool {
+			record.AddAttrs(flatten(h.groups, a)...)
+			return true
+		})
+
+		if h.match == nil || h.match(record) {
+			h.m.Send(h.newEvent(ctx, record))
+		}
+	}
+
+	if !h.next.Enabled(ctx, r.Level) {
+		return nil
+	}
+
+	return h.next.Handle(ctx, r)
+}
+
+// WithAttrs implements the slog.Handler interface
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.next = h.next.WithAttrs(attrs)
+	c.attrs = append([]slog.Attr{}, h.attrs...)
+	for _, a := range attrs {
+		c.attrs = append(c.attrs, flatten(h.groups, a)...)
+	}
+
+	return &c
+}
+
+// WithGroup implements the slog.Handler interface
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	c := *h
+	c.next = h.next.WithGroup(name)
+	c.groups = append(append([]string{}, h.groups...), name)
+	return &c
+}
+
+// newEvent converts the record into an event
+func (h *SlogHandler) newEvent(ctx context.Context, r slog.Record) *Event {
+	event := Event{
+		Name:       r.Message,
+		Properties: make(map[string]interface{}),
+	}
+
+	if !r.Time.IsZero() {
+		event.Time = r.Time.UnixMilli()
+	}
+
+	if id, ok := IdentityFromContext(ctx); ok {
+		event.UserId, event.DeviceId = id.UserId, id.DeviceId
+	}
+
+	r.Attrs(func(a slog.Attr) bool {
+		switch a.Key {
+		case h.nameKey:
+			event.Name = a.Value.String()
+			event.Properties["message"] = r.Message
+		case h.userKey:
+			event.UserId = a.Value.String()
+		case h.deviceKey:
+			event.DeviceId = a.Value.String()
+		default:
+			event.Properties[a.Key] = slogValue(a.Value)
+		}
+
+		return true
+	})
+
+	return event.Trace(ctx)
+}
+
+// slogValue converts an attribute value to a property value serialized as it is logged
+func slogValue(v slog.Value) interface{} {
+	v = v.Resolve()
+	switch v.Kind() {
+	case slog.KindDuration:
+		return v.Duration().String()
+	case slog.KindTime:
+		return v.Time().Format(time.RFC3339Nano)
+	case slog.KindAny:
+		switch a := v.Any().(type) {
+		case error:
+			return a.Error()
+		case fmt.Stringer:
+			return a.String()
+		}
+	}
+
+	return v.Any()
+}
+
+// flatten resolves the attribute into attributes prefixed by their groups
+func flatten(groups []string, a slog.Attr) []slog.Attr {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return nil
+	}
+
+	if a.Value.Kind() != slog.KindGroup {
+		a.Key = strings.Join(append(append([]string{}, groups...), a.Key), ".")
+		return []slog.Attr{a}
+	}
+
+	// attributes of groups without a key are inlined
+	if a.Key != "" {
+		groups = append(append([]string{}, groups...), a.Key)
+	}
+
+	var attrs []slog.Attr
+	for _, ga := range a.Value.Group() {
+		attrs = append(attrs, flatten(groups, ga)...)
+	}
+
+	return attrs
+}
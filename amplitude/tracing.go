@@ -0,0 +1,95 @@
+package amplitude
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation name of the spans of the client
+const tracerName = "github.com/pghq/go-amplitude/amplitude"
+
+// batchSizeKey is the context key of the number of events uploaded by a request
+type batchSizeKey struct{}
+
+// WithTracerProvider sets the provider of the tracer creating spans for the requests to Amplitude,
+// the global provider is used by default
+func (c *Client) WithTracerProvider(tp trace.TracerProvider) *Client {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+
+	c.tracer = tp.Tracer(tracerName)
+	return c
+}
+
+// Trace records the trace and span ids of the active span of the context, if any
+func (e *Event) Trace(ctx context.Context) *Event {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return e
+	}
+
+	if e.Properties == nil {
+		e.Properties = make(map[string]interface{})
+	}
+
+	e.Properties["trace_id"] = sc.TraceID().String()
+	e.Properties["span_id"] = sc.SpanID().String()
+	return e
+}
+
+// withBatchSize records the number of events uploaded by requests made with the context
+func withBatchSize(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, batchSizeKey{}, n)
+}
+
+// startSpan starts the client span of a request, returning the request carrying it
+func (c *Client) startSpan(req *http.Request) (*http.Request, trace.Span) {
+	ctx := req.Context()
+	attrs := []attribute.KeyValue{attribute.String("http.request.method", req.Method)}
+	if req.URL != nil {
+		attrs = append(attrs,
+			attribute.String("server.address", req.URL.Hostname()),
+			attribute.String("url.path", req.URL.Path))
+	}
+
+	if n, ok := ctx.Value(batchSizeKey{}).(int); ok {
+		attrs = append(attrs, attribute.Int("amplitude.batch_size", n))
+	}
+
+	ctx, span := c.tracer.Start(ctx, "amplitude "+req.Method+" "+endpoint(req),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...))
+
+	return req.WithContext(ctx), span
+}
+
+// endSpan records the result of the request on its span and ends it
+func endSpan(span trace.Span, resp *http.Response, v interface{}, err error) {
+	defer span.End()
+
+	if resp != nil {
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	}
+
+	if aerr, ok := err.(*Error); ok {
+		span.SetAttributes(attribute.Int("http.response.status_code", aerr.Response.StatusCode))
+	}
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+
+	if s, ok := v.(*BatchEventsSuccessSummary); ok {
+		span.SetAttributes(
+			attribute.Int("amplitude.events_ingested", s.EventsIngested),
+			attribute.Int("amplitude.payload_size", s.PayloadSize))
+	}
+}
@@ -0,0 +1,146 @@
+package amplitude
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/pghq/go-museum/museum/diagnostic/errors"
+)
+
+// Schema is the subset of JSON Schema used to describe tracking plan properties
+type Schema struct {
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 SchemaType         `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+}
+
+// SchemaType is the list of JSON types a schema allows,
+// it may be written as a single type or an array of types
+type SchemaType []string
+
+// UnmarshalJSON accepts a single type or an array of types
+func (t *SchemaType) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = SchemaType{single}
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+
+	*t = many
+	return nil
+}
+
+// Is checks if the schema allows the type
+func (t SchemaType) Is(name string) bool {
+	for _, v := range t {
+		if v == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsRequired checks if the property is required by the schema
+func (s *Schema) IsRequired(name string) bool {
+	for _, v := range s.Required {
+		if v == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PlannedEvent is an event of the tracking plan and the schemas of its properties
+type PlannedEvent struct {
+	Name           string  `json:"name"`
+	Description    string  `json:"description,omitempty"`
+	Properties     *Schema `json:"event_properties,omitempty"`
+	UserProperties *Schema `json:"user_properties,omitempty"`
+}
+
+// TrackingPlan lists the planned events of a project
+type TrackingPlan struct {
+	Events []*PlannedEvent `json:"events"`
+
+	// Strict treats events missing from the plan as violations
+	Strict bool `json:"strict,omitempty"`
+
+	lock       sync.Mutex
+	violations map[string]int64
+}
+
+// LoadTrackingPlan reads a tracking plan, either as an object listing
+// the events ({"events": [{"name": ..., "event_properties": {...}}]})
+// or as an array of JSON Schemas titled with the event name
+// (as exported by Amplitude Data)
+func LoadTrackingPlan(r io.Reader) (*TrackingPlan, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	var plan TrackingPlan
+	var schemas []*Schema
+	if err := json.Unmarshal(data, &schemas); err == nil {
+		for _, schema := range schemas {
+			plan.Events = append(plan.Events, &PlannedEvent{
+				Name:        schema.Title,
+				Description: schema.Description,
+				Properties:  schema,
+			})
+		}
+	} else if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	for i, event := range plan.Events {
+		if event.Name == "" {
+			return nil, errors.Newf("amplitude: tracking plan event %d has no name", i)
+		}
+	}
+
+	return &plan, nil
+}
+
+// OpenTrackingPlan reads a tracking plan from a file
+func OpenTrackingPlan(path string) (*TrackingPlan, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	defer f.Close()
+
+	return LoadTrackingPlan(f)
+}
+
+// Event gets the planned event with the name
+func (p *TrackingPlan) Event(name string) (*PlannedEvent, bool) {
+	for _, event := range p.Events {
+		if event.Name == name {
+			return event, true
+		}
+	}
+
+	return nil, false
+}
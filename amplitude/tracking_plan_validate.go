@@ -0,0 +1,290 @@
+package amplitude
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// PlanMode is how events violating the tracking plan are handled
+type PlanMode int
+
+const (
+	// PlanWarn reports violations but still sends the events
+	PlanWarn PlanMode = iota
+
+	// PlanDrop silently drops violating events
+	PlanDrop
+
+	// PlanBlock leaves violating events out of uploads, reporting their violations
+	PlanBlock
+)
+
+// PlanViolation lists the ways an event does not match the tracking plan
+type PlanViolation struct {
+	Event    *Event
+	Problems []string
+}
+
+// Error implements the error interface
+func (v *PlanViolation) Error() string {
+	return fmt.Sprintf("amplitude: event %s violates the tracking plan: %s", v.Event.Name, strings.Join(v.Problems, "; "))
+}
+
+// patterns caches the compiled schema patterns
+var patterns sync.Map
+
+// Check validates the event properties and user properties against the plan,
+// counting a violation for the event type if they do not match
+func (p *TrackingPlan) Check(event *Event) error {
+	var problems []string
+	planned, ok := p.Event(event.Name)
+	switch {
+	case ok:
+		problems = append(problems, planned.Properties.validate("event_properties", normalizeObject(event.Properties))...)
+		problems = append(problems, planned.UserProperties.validate("user_properties", normalizeObject(event.UserProperties))...)
+	case p.Strict:
+		problems = append(problems, "event is not in the tracking plan")
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.violations == nil {
+		p.violations = make(map[string]int64)
+	}
+	p.violations[event.Name]++
+
+	return &PlanViolation{Event: event, Problems: problems}
+}
+
+// Violations gets the number of violations counted per event type
+func (p *TrackingPlan) Violations() map[string]int64 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	violations := make(map[string]int64, len(p.violations))
+	for k, v := range p.violations {
+		violations[k] = v
+	}
+
+	return violations
+}
+
+// TrackingPlan sets the plan buffered events are validated against
+func (m *SendMiddleware) TrackingPlan(plan *TrackingPlan, mode PlanMode) *SendMiddleware {
+	m.plan = plan
+	m.planMode = mode
+	return m
+}
+
+// WithTrackingPlan sets the plan sent events are validated against
+func (c *Client) WithTrackingPlan(plan *TrackingPlan, mode PlanMode) *Client {
+	c.plan = plan
+	c.planMode = mode
+	return c
+}
+
+// enforce checks the events against the plan, returning the events which may be sent and the violations
+// of the events blocked, violations are reported through the error hook or logger of the client in warn mode
+func (c *Client) enforce(ctx context.Context, events []*Event) ([]*Event, []*PlanViolation) {
+	if c.plan == nil {
+		return events, nil
+	}
+
+	var blocked []*PlanViolation
+	allowed := events[:0:0]
+	for _, event := range events {
+		err := c.plan.Check(event)
+		switch {
+		case err == nil:
+			allowed = append(allowed, event)
+		case c.planMode == PlanWarn:
+			c.report(ctx, LogWarn, "amplitude: event violates the tracking plan", err)
+			allowed = append(allowed, event)
+		case c.planMode == PlanBlock:
+			blocked = append(blocked, err.(*PlanViolation))
+		}
+	}
+
+	return allowed, blocked
+}
+
+// validate checks a value against the schema, returning the problems found at the path
+func (s *Schema) validate(path string, v interface{}) []string {
+	if s == nil {
+		return nil
+	}
+
+	if len(s.Type) > 0 && !s.Type.matches(v) {
+		return []string{fmt.Sprintf("%s: expected %s", path, strings.Join(s.Type, " or "))}
+	}
+
+	var problems []string
+	if len(s.Enum) > 0 {
+		var found bool
+		for _, e := range normalize(s.Enum).([]interface{}) {
+			if reflect.DeepEqual(e, v) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			problems = append(problems, fmt.Sprintf("%s: %v is not one of %v", path, v, s.Enum))
+		}
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		problems = append(problems, s.validateObject(path, v)...)
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			problems = append(problems, fmt.Sprintf("%s: has fewer than %d items", path, *s.MinItems))
+		}
+
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			problems = append(problems, fmt.Sprintf("%s: has more than %d items", path, *s.MaxItems))
+		}
+
+		for i, e := range v {
+			problems = append(problems, s.Items.validate(fmt.Sprintf("%s[%d]", path, i), e)...)
+		}
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.MinLength != nil && n < *s.MinLength {
+			problems = append(problems, fmt.Sprintf("%s: is shorter than %d characters", path, *s.MinLength))
+		}
+
+		if s.MaxLength != nil && n > *s.MaxLength {
+			problems = append(problems, fmt.Sprintf("%s: is longer than %d characters", path, *s.MaxLength))
+		}
+
+		if s.Pattern != "" {
+			if re := pattern(s.Pattern); re == nil || !re.MatchString(v) {
+				problems = append(problems, fmt.Sprintf("%s: does not match %s", path, s.Pattern))
+			}
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			problems = append(problems, fmt.Sprintf("%s: %v is less than %v", path, v, *s.Minimum))
+		}
+
+		if s.Maximum != nil && v > *s.Maximum {
+			problems = append(problems, fmt.Sprintf("%s: %v is greater than %v", path, v, *s.Maximum))
+		}
+	}
+
+	return problems
+}
+
+// validateObject checks the required, known and additional properties of an object
+func (s *Schema) validateObject(path string, v map[string]interface{}) []string {
+	var problems []string
+	for _, key := range s.Required {
+		if _, ok := v[key]; !ok {
+			problems = append(problems, fmt.Sprintf("%s.%s: is required", path, key))
+		}
+	}
+
+	keys := make([]string, 0, len(v))
+	for key := range v {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		prop, ok := s.Properties[key]
+		if !ok {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				problems = append(problems, fmt.Sprintf("%s.%s: is not allowed", path, key))
+			}
+			continue
+		}
+
+		problems = append(problems, prop.validate(path+"."+key, v[key])...)
+	}
+
+	return problems
+}
+
+// matches checks if a normalized value is one of the types
+func (t SchemaType) matches(v interface{}) bool {
+	for _, name := range t {
+		switch v := v.(type) {
+		case nil:
+			if name == "null" {
+				return true
+			}
+		case bool:
+			if name == "boolean" {
+				return true
+			}
+		case string:
+			if name == "string" {
+				return true
+			}
+		case float64:
+			if name == "number" || (name == "integer" && v == math.Trunc(v)) {
+				return true
+			}
+		case []interface{}:
+			if name == "array" {
+				return true
+			}
+		case map[string]interface{}:
+			if name == "object" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// normalizeObject normalizes a property map, treating a missing map as empty
+func normalizeObject(m map[string]interface{}) interface{} {
+	if m == nil {
+		return map[string]interface{}{}
+	}
+
+	return normalize(m)
+}
+
+// normalize converts a value to its JSON representation (e.g. ints to float64, []string to []interface{})
+func normalize(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+
+	var n interface{}
+	_ = json.Unmarshal(data, &n)
+	return n
+}
+
+// pattern gets the compiled regular expression of a schema pattern
+func pattern(expr string) *regexp.Regexp {
+	if re, ok := patterns.Load(expr); ok {
+		return re.(*regexp.Regexp)
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil
+	}
+
+	patterns.Store(expr, re)
+	return re
+}
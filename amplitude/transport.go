@@ -0,0 +1,125 @@
+package amplitude
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// identityKey is the context key of the tracked identity
+type identityKey struct{}
+
+// Identity is the user and device activity is attributed to
+type Identity struct {
+	UserId   string
+	DeviceId string
+}
+
+// WithIdentity attaches the user and device ids to the context
+func WithIdentity(ctx context.Context, userId, deviceId string) context.Context {
+	return context.WithValue(ctx, identityKey{}, Identity{UserId: userId, DeviceId: deviceId})
+}
+
+// IdentityFromContext gets the user and device ids attached to the context
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok && (id.UserId != "" || id.DeviceId != "")
+}
+
+// retriesKey is the context key of the number of times a request was retried
+type retriesKey struct{}
+
+// WithRetries records how many times the request made with the context was retried,
+// so retrying clients wrapping the transport can report their attempts
+func WithRetries(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, retriesKey{}, n)
+}
+
+// RetriesFromContext gets the number of retries recorded in the context
+func RetriesFromContext(ctx context.Context) int {
+	n, _ := ctx.Value(retriesKey{}).(int)
+	return n
+}
+
+// Transport is a http.RoundTripper sending events for outbound requests
+// made on behalf of the identity found in the request context
+type Transport struct {
+	base       http.RoundTripper
+	middleware *SendMiddleware
+	route      func(r *http.Request) string
+}
+
+// Transport creates a new http transport sending events through the middleware
+func (m *SendMiddleware) Transport(base http.RoundTripper) *Transport {
+	return NewTransport(m, base)
+}
+
+// NewTransport creates a new instance of the amplitude transport,
+// the default http transport is wrapped if base is nil
+func NewTransport(m *SendMiddleware, base http.RoundTripper) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	t := Transport{
+		base:       base,
+		middleware: m,
+	}
+
+	return &t
+}
+
+// Route sets the function naming the route template of requests (e.g. /users/{id}),
+// events are named after the host alone by default so ids in paths do not create new event types
+func (t *Transport) Route(fn func(r *http.Request) string) *Transport {
+	t.route = fn
+	return t
+}
+
+// RoundTrip implements the http.RoundTripper interface
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(r)
+	if id, ok := IdentityFromContext(r.Context()); ok {
+		t.middleware.Send(t.newEvent(r, id, resp, err, time.Since(start)))
+	}
+
+	return resp, err
+}
+
+// newEvent creates an event for the outbound request
+func (t *Transport) newEvent(r *http.Request, id Identity, resp *http.Response, err error, latency time.Duration) *Event {
+	event := Event{
+		UserId:   id.UserId,
+		DeviceId: id.DeviceId,
+		Name:     fmt.Sprintf("%s %s", r.Method, r.URL.Host),
+		Time:     time.Now().UnixMilli(),
+		Properties: map[string]interface{}{
+			"outbound": true,
+			"host":     r.URL.Host,
+			"path":     r.URL.Path,
+			"retries":  RetriesFromContext(r.Context()),
+		},
+	}
+
+	if t.route != nil {
+		route := t.route(r)
+		event.Name += route
+		event.Properties["route"] = route
+	}
+
+	var status int
+	if resp != nil {
+		status = resp.StatusCode
+	}
+
+	if err != nil {
+		event.Properties["error"] = err.Error()
+	}
+
+	return event.Latency(latency.Milliseconds()).
+		Status(status).
+		Environment(t.middleware.environment).
+		Version(t.middleware.version)
+}
@@ -0,0 +1,163 @@
+package amplitude
+
+import (
+	"strings"
+
+	"github.com/mssola/user_agent"
+)
+
+const (
+	// DeviceDesktop is the device type of desktop clients
+	DeviceDesktop = "desktop"
+
+	// DeviceMobile is the device type of phones
+	DeviceMobile = "mobile"
+
+	// DeviceTablet is the device type of tablets
+	DeviceTablet = "tablet"
+
+	// DeviceBot is the device type of crawlers and other automated clients
+	DeviceBot = "bot"
+)
+
+// UserAgent is the client information parsed from a user agent string
+type UserAgent struct {
+	OSName             string
+	OSVersion          string
+	Browser            string
+	BrowserVersion     string
+	DeviceType         string
+	DeviceBrand        string
+	DeviceManufacturer string
+	DeviceModel        string
+	Bot                bool
+}
+
+// UserAgentParser parses user agent strings, allowing richer databases to be swapped in
+type UserAgentParser interface {
+	Parse(ua string) UserAgent
+}
+
+// UserAgentParserFunc adapts a function to the UserAgentParser interface
+type UserAgentParserFunc func(ua string) UserAgent
+
+// Parse calls the function
+func (f UserAgentParserFunc) Parse(ua string) UserAgent {
+	return f(ua)
+}
+
+// DefaultUserAgentParser parses user agents using github.com/mssola/user_agent
+var DefaultUserAgentParser UserAgentParser = UserAgentParserFunc(parseUserAgent)
+
+// UserAgentParser sets the parser used for request user agents
+func (m *SendMiddleware) UserAgentParser(p UserAgentParser) *SendMiddleware {
+	if p != nil {
+		m.uaParser = p
+	}
+
+	return m
+}
+
+// DropBots drops requests from crawlers instead of tracking them
+func (m *SendMiddleware) DropBots(enabled bool) *SendMiddleware {
+	m.dropBots = enabled
+	return m
+}
+
+// apply copies the user agent information to the event
+func (ua UserAgent) apply(e *Event) {
+	if ua.Browser != "" || ua.OSName != "" {
+		e.Platform = "Web"
+	}
+
+	e.OSName = ua.OSName
+	e.OSVersion = ua.OSVersion
+	e.DeviceBrand = ua.DeviceBrand
+	e.DeviceManufacturer = ua.DeviceManufacturer
+	e.DeviceModel = ua.DeviceModel
+
+	if ua.Browser != "" {
+		e.Properties["browser"] = ua.Browser
+	}
+
+	if ua.BrowserVersion != "" {
+		e.Properties["browser_version"] = ua.BrowserVersion
+	}
+
+	if ua.DeviceType != "" {
+		e.Properties["device_type"] = ua.DeviceType
+	}
+
+	if ua.Bot {
+		e.Properties["bot"] = true
+	}
+}
+
+// parseUserAgent is the default user agent parser
+func parseUserAgent(s string) UserAgent {
+	p := user_agent.New(s)
+	os := p.OSInfo()
+	ua := UserAgent{
+		OSName:    os.Name,
+		OSVersion: os.Version,
+		Bot:       p.Bot(),
+	}
+
+	ua.Browser, ua.BrowserVersion = p.Browser()
+
+	// the platform is only a device model for Apple devices, e.g. it is X11 or Windows on desktops
+	platform := p.Platform()
+	switch platform {
+	case "Macintosh", "iPhone", "iPad", "iPod", "iPod touch":
+		ua.DeviceModel = platform
+		ua.DeviceBrand, ua.DeviceManufacturer = "Apple", "Apple"
+	}
+
+	if strings.Contains(s, "Android") {
+		ua.DeviceModel = androidModel(s)
+	}
+
+	switch {
+	case ua.Bot:
+		ua.DeviceType = DeviceBot
+	case platform == "iPad" || (strings.Contains(os.Name, "Android") && !strings.Contains(s, "Mobile")):
+		ua.DeviceType = DeviceTablet
+	case p.Mobile():
+		ua.DeviceType = DeviceMobile
+	case s != "":
+		ua.DeviceType = DeviceDesktop
+	}
+
+	return ua
+}
+
+// androidModel finds the device model in the comment of an Android user agent,
+// e.g. SM-G973F in "(Linux; Android 10; SM-G973F Build/QP1A.190711.020)"
+func androidModel(s string) string {
+	start := strings.Index(s, "(")
+	end := strings.Index(s, ")")
+	if start < 0 || end < start {
+		return ""
+	}
+
+	var model string
+	parts := strings.Split(s[start+1:end], ";")
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		if j := strings.Index(part, " Build/"); j >= 0 {
+			return part[:j]
+		}
+
+		if model == "" && i > 0 && strings.HasPrefix(strings.TrimSpace(parts[i-1]), "Android") {
+			model = part
+		}
+	}
+
+	// reduced user agents replace the model with K, webviews may add wv instead
+	switch model {
+	case "K", "wv":
+		return ""
+	}
+
+	return model
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 PGHQ. All Rights Reserved.
+//
+// Licensed under the GNU General Public License, Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command amplitude-emulator serves an in-memory emulator of the Amplitude ingestion APIs
+// (/batch, /2/httpapi, /identify and /groupidentify) for local development.
+//
+// The events received may be inspected with GET /events and cleared with DELETE /events.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/pghq/go-amplitude/amplitude/amplitudetest"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "address to listen on")
+	apiKey := flag.String("api-key", "", "api key requests must use, any key is accepted if empty")
+	eps := flag.Int("eps", amplitudetest.DefaultEventsPerSecond, "events per second per user or device before throttling, 0 to disable")
+	limit := flag.Int("event-limit", amplitudetest.DefaultEventLimit, "max number of events per upload")
+	flag.Parse()
+
+	e := amplitudetest.NewEmulator().
+		APIKey(*apiKey).
+		EventsPerSecond(*eps).
+		EventLimit(*limit)
+
+	fmt.Fprintf(os.Stderr, "amplitude-emulator: listening on http://%s\n", *addr)
+	if err := http.ListenAndServe(*addr, newHandler(e)); err != nil {
+		fmt.Fprintln(os.Stderr, "amplitude-emulator:", err)
+		os.Exit(1)
+	}
+}
+
+// newHandler serves the emulator along with the endpoint inspecting its events
+func newHandler(e *amplitudetest.Emulator) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/", e)
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"events":                e.Events(),
+				"identifications":       e.Identifications(),
+				"group_identifications": e.GroupIdentifications(),
+			})
+		case http.MethodDelete:
+			e.Reset()
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "GET, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	return mux
+}
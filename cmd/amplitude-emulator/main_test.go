@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pghq/go-amplitude/amplitude"
+	"github.com/pghq/go-amplitude/amplitude/amplitudetest"
+)
+
+func TestHandler(t *testing.T) {
+	t.Run("serves and inspects events", func(t *testing.T) {
+		server := httptest.NewServer(newHandler(amplitudetest.NewEmulator().APIKey("test-key")))
+		defer server.Close()
+
+		client := amplitude.New("test-key")
+		client.BaseURL, _ = url.Parse(server.URL)
+		_, err := client.Events.Send(context.TODO(), &amplitude.Event{Name: "Signed Up", UserId: "test-user"})
+		assert.Nil(t, err)
+
+		resp, err := http.Get(server.URL + "/events")
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+
+		var body struct{ Events []*amplitude.Event }
+		assert.Nil(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Len(t, body.Events, 1)
+		assert.Equal(t, "test-user", body.Events[0].UserId)
+
+		req, _ := http.NewRequest(http.MethodDelete, server.URL+"/events", nil)
+		resp, err = http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+		resp, err = http.Post(server.URL+"/events", "application/json", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	})
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/pghq/go-amplitude/amplitude"
+)
+
+// eventModel is a planned event prepared for the template
+type eventModel struct {
+	Name           string
+	GoName         string
+	Description    string
+	Properties     []propertyModel
+	UserProperties []propertyModel
+	Constants      []constantModel
+}
+
+// propertyModel is a planned property prepared for the template
+type propertyModel struct {
+	Key         string
+	Field       string
+	Param       string
+	Type        string
+	Description string
+	Required    bool
+	Pointer     bool
+}
+
+// constantModel is an enum value of a string property
+type constantModel struct {
+	Name  string
+	Value string
+}
+
+// Params lists the required properties of the event as constructor parameters
+func (e eventModel) Params() []propertyModel {
+	var params []propertyModel
+	for _, p := range e.Properties {
+		if p.Required {
+			params = append(params, p)
+		}
+	}
+
+	for _, p := range e.UserProperties {
+		if p.Required {
+			params = append(params, p)
+		}
+	}
+
+	return params
+}
+
+// declarations lists the package level identifiers generated for the event
+func (e eventModel) declarations() []string {
+	names := []string{e.GoName, "New" + e.GoName}
+	if len(e.UserProperties) > 0 {
+		names = append(names, e.GoName+"UserProperties")
+	}
+
+	for _, c := range e.Constants {
+		names = append(names, c.Name)
+	}
+
+	return names
+}
+
+// check rejects properties generating fields or parameters which clash
+func (e eventModel) check() error {
+	for _, p := range e.Properties {
+		if p.Field == "Event" {
+			return fmt.Errorf("property %q clashes with the Event method", p.Key)
+		}
+
+		if p.Field == "User" && len(e.UserProperties) > 0 {
+			return fmt.Errorf("property %q clashes with the User field of the user properties", p.Key)
+		}
+	}
+
+	// e is the variable the constructor builds the event in
+	params := map[string]string{"e": "the constructor variable"}
+	for _, p := range e.Params() {
+		if other, ok := params[p.Param]; ok {
+			return fmt.Errorf("property %q clashes with %s as the parameter %s", p.Key, other, p.Param)
+		}
+		params[p.Param] = fmt.Sprintf("property %q", p.Key)
+	}
+
+	return nil
+}
+
+// Generate creates the go source of the typed events of the plan
+func Generate(plan *amplitude.TrackingPlan, pkg string) ([]byte, error) {
+	var events []eventModel
+	names := make(map[string]string)
+	for _, event := range plan.Events {
+		model, err := newEventModel(event)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range model.declarations() {
+			if other, ok := names[name]; ok {
+				return nil, fmt.Errorf("events %q and %q both generate %s", other, event.Name, name)
+			}
+			names[name] = event.Name
+		}
+
+		events = append(events, model)
+	}
+
+	var buf bytes.Buffer
+	if err := eventsTemplate.Execute(&buf, map[string]interface{}{
+		"Package": pkg,
+		"Events":  events,
+	}); err != nil {
+		return nil, err
+	}
+
+	return format.Source(buf.Bytes())
+}
+
+// newEventModel prepares a planned event for the template
+func newEventModel(event *amplitude.PlannedEvent) (eventModel, error) {
+	model := eventModel{
+		Name:        event.Name,
+		GoName:      identifier(event.Name),
+		Description: event.Description,
+	}
+
+	var err error
+	if model.Properties, err = newPropertyModels(event.Properties, ""); err != nil {
+		return model, fmt.Errorf("event %q: %v", event.Name, err)
+	}
+
+	if model.UserProperties, err = newPropertyModels(event.UserProperties, "user"); err != nil {
+		return model, fmt.Errorf("event %q user properties: %v", event.Name, err)
+	}
+
+	for _, prefix := range []string{"", "User"} {
+		schema, props := event.Properties, model.Properties
+		if prefix != "" {
+			schema, props = event.UserProperties, model.UserProperties
+		}
+
+		for _, p := range props {
+			for _, v := range schema.Properties[p.Key].Enum {
+				if s, ok := v.(string); ok {
+					model.Constants = append(model.Constants, constantModel{
+						Name:  model.GoName + prefix + p.Field + identifier(s),
+						Value: s,
+					})
+				}
+			}
+		}
+	}
+
+	if err := model.check(); err != nil {
+		return model, fmt.Errorf("event %q: %v", event.Name, err)
+	}
+
+	return model, nil
+}
+
+// newPropertyModels prepares the properties of an object schema for the template
+func newPropertyModels(schema *amplitude.Schema, paramPrefix string) ([]propertyModel, error) {
+	if schema == nil {
+		return nil, nil
+	}
+
+	keys := make([]string, 0, len(schema.Properties))
+	for key := range schema.Properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var props []propertyModel
+	fields := make(map[string]string)
+	for _, key := range keys {
+		prop := schema.Properties[key]
+		field := identifier(key)
+		if other, ok := fields[field]; ok {
+			return nil, fmt.Errorf("properties %q and %q both generate %s", other, key, field)
+		}
+		fields[field] = key
+
+		typ, nilable := goType(prop)
+		required := schema.IsRequired(key)
+		pointer := !required && !nilable
+		if pointer {
+			typ = "*" + typ
+		}
+
+		props = append(props, propertyModel{
+			Key:         key,
+			Field:       field,
+			Param:       parameter(paramPrefix + field),
+			Type:        typ,
+			Description: prop.Description,
+			Required:    required,
+			Pointer:     pointer,
+		})
+	}
+
+	return props, nil
+}
+
+// goType maps a schema to a go type and whether the type can be nil
+func goType(schema *amplitude.Schema) (string, bool) {
+	if schema == nil {
+		return "interface{}", true
+	}
+
+	var types []string
+	for _, t := range schema.Type {
+		if t != "null" {
+			types = append(types, t)
+		}
+	}
+
+	if len(types) != 1 {
+		return "interface{}", true
+	}
+
+	switch types[0] {
+	case "string":
+		return "string", false
+	case "integer":
+		return "int64", false
+	case "number":
+		return "float64", false
+	case "boolean":
+		return "bool", false
+	case "array":
+		item, _ := goType(schema.Items)
+		return "[]" + item, true
+	case "object":
+		return "map[string]interface{}", true
+	}
+
+	return "interface{}", true
+}
+
+// identifier converts a name to an exported go identifier (e.g. "song played" to SongPlayed)
+func identifier(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+
+		if b.Len() == 0 && unicode.IsDigit(r) {
+			b.WriteRune('X')
+		}
+
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+
+		b.WriteRune(r)
+	}
+
+	if b.Len() == 0 {
+		return "X"
+	}
+
+	return b.String()
+}
+
+// parameter converts an identifier to an unexported parameter name
+func parameter(name string) string {
+	r := []rune(name)
+	r[0] = unicode.ToLower(r[0])
+	param := string(r)
+	if token.IsKeyword(param) {
+		param += "_"
+	}
+
+	return param
+}
+
+// comment formats text as the lines of a go comment
+func comment(text string) string {
+	return strings.Join(strings.Split(strings.TrimSpace(text), "\n"), "\n// ")
+}
+
+var eventsTemplate = template.Must(template.New("events").Funcs(template.FuncMap{
+	"comment": comment,
+}).Parse(`// Code generated by amplitude-gen. DO NOT EDIT.
+
+package {{ .Package }}
+
+import (
+	"time"
+
+	"github.com/pghq/go-amplitude/amplitude"
+)
+{{ range .Events }}{{ $event := . }}
+{{- if .Constants }}
+// Values of the enum properties of the {{ printf "%q" .Name }} event
+const (
+{{- range .Constants }}
+	{{ .Name }} = {{ printf "%q" .Value }}
+{{- end }}
+)
+{{ end }}
+// {{ .GoName }} is the {{ printf "%q" .Name }} event
+{{- if .Description }}
+// {{ comment .Description }}
+{{- end }}
+type {{ .GoName }} struct {
+{{- range .Properties }}
+{{- if .Description }}
+	// {{ comment .Description }}
+{{- end }}
+	{{ .Field }} {{ .Type }}
+{{- end }}
+{{- if .UserProperties }}
+
+	// User are the user properties set with the event
+	User {{ .GoName }}UserProperties
+{{- end }}
+}
+{{ if .UserProperties }}
+// {{ .GoName }}UserProperties are the user properties of the {{ printf "%q" .Name }} event
+type {{ .GoName }}UserProperties struct {
+{{- range .UserProperties }}
+{{- if .Description }}
+	// {{ comment .Description }}
+{{- end }}
+	{{ .Field }} {{ .Type }}
+{{- end }}
+}
+{{ end }}
+// New{{ .GoName }} creates a {{ printf "%q" .Name }} event with its required properties
+func New{{ .GoName }}({{ range $i, $p := .Params }}{{ if $i }}, {{ end }}{{ $p.Param }} {{ $p.Type }}{{ end }}) *{{ .GoName }} {
+	e := {{ .GoName }}{
+{{- range .Properties }}{{ if .Required }}
+		{{ .Field }}: {{ .Param }},
+{{- end }}{{ end }}
+	}
+{{- range .UserProperties }}{{ if .Required }}
+	e.User.{{ .Field }} = {{ .Param }}
+{{- end }}{{ end }}
+
+	return &e
+}
+
+// Event converts the typed event to an amplitude event for the user or device
+func (e *{{ .GoName }}) Event(userId, deviceId string) *amplitude.Event {
+	event := amplitude.Event{
+		UserId:     userId,
+		DeviceId:   deviceId,
+		Name:       {{ printf "%q" .Name }},
+		Time:       time.Now().UnixMilli(),
+		Properties: make(map[string]interface{}),
+	}
+{{ range .Properties }}
+{{- if .Required }}
+	event.Properties[{{ printf "%q" .Key }}] = e.{{ .Field }}
+{{- else if .Pointer }}
+	if e.{{ .Field }} != nil {
+		event.Properties[{{ printf "%q" .Key }}] = *e.{{ .Field }}
+	}
+{{- else }}
+	if e.{{ .Field }} != nil {
+		event.Properties[{{ printf "%q" .Key }}] = e.{{ .Field }}
+	}
+{{- end }}
+{{- end }}
+{{- if .UserProperties }}
+
+	event.UserProperties = make(map[string]interface{})
+{{- range .UserProperties }}
+{{- if .Required }}
+	event.UserProperties[{{ printf "%q" .Key }}] = e.User.{{ .Field }}
+{{- else if .Pointer }}
+	if e.User.{{ .Field }} != nil {
+		event.UserProperties[{{ printf "%q" .Key }}] = *e.User.{{ .Field }}
+	}
+{{- else }}
+	if e.User.{{ .Field }} != nil {
+		event.UserProperties[{{ printf "%q" .Key }}] = e.User.{{ .Field }}
+	}
+{{- end }}
+{{- end }}
+{{- end }}
+
+	return &event
+}
+{{ end }}`))
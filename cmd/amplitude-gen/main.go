@@ -0,0 +1,57 @@
+// Copyright 2021 PGHQ. All Rights Reserved.
+//
+// Licensed under the GNU General Public License, Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command amplitude-gen generates typed Go events from a tracking plan.
+//
+// It is intended to be used with go generate:
+//
+//	//go:generate go run github.com/pghq/go-amplitude/cmd/amplitude-gen -plan tracking-plan.json -package analytics -o events.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/pghq/go-amplitude/amplitude"
+)
+
+func main() {
+	planPath := flag.String("plan", "tracking-plan.json", "path of the tracking plan")
+	pkg := flag.String("package", os.Getenv("GOPACKAGE"), "package name of the generated code")
+	out := flag.String("o", "amplitude_events.go", "path of the generated file")
+	flag.Parse()
+
+	if err := run(*planPath, *pkg, *out); err != nil {
+		fmt.Fprintln(os.Stderr, "amplitude-gen:", err)
+		os.Exit(1)
+	}
+}
+
+// run generates the typed events of the plan into the output file
+func run(planPath, pkg, out string) error {
+	if pkg == "" {
+		return fmt.Errorf("no package name")
+	}
+
+	plan, err := amplitude.OpenTrackingPlan(planPath)
+	if err != nil {
+		return err
+	}
+
+	src, err := Generate(plan, pkg)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(out, src, 0o644)
+}
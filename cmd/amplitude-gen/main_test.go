@@ -0,0 +1,135 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pghq/go-amplitude/amplitude"
+)
+
+func TestGenerate(t *testing.T) {
+	t.Run("generates typed events", func(t *testing.T) {
+		out := filepath.Join(t.TempDir(), "events.go")
+		err := run("../../amplitude/testdata/tracking-plan.json", "analytics", out)
+		assert.Nil(t, err)
+
+		src, _ := os.ReadFile(out)
+		code := string(src)
+		assert.True(t, strings.HasPrefix(code, "// Code generated by amplitude-gen. DO NOT EDIT."))
+		assert.Contains(t, code, "func NewSongPlayed(duration int64, title string, userPlan string) *SongPlayed {")
+		assert.Contains(t, code, "\t// Title of the song\n\tTitle string\n")
+		assert.Contains(t, code, "\tGenres   []string\n")
+		assert.Contains(t, code, "\tRating   *float64\n")
+		assert.Contains(t, code, "\tFavoriteGenre *string\n")
+		assert.Contains(t, code, "\tSongPlayedSourceSearch    = \"search\"\n")
+		assert.Contains(t, code, "event.Properties[\"title\"] = e.Title")
+		assert.Contains(t, code, "event.UserProperties[\"plan\"] = e.User.Plan")
+		assert.Contains(t, code, "func (e *SignedUp) Event(userId, deviceId string) *amplitude.Event {")
+
+		// the generated package is built inside the module so it can import amplitude
+		dir := filepath.Join("testdata", "analytics")
+		assert.Nil(t, os.MkdirAll(dir, 0o755))
+		defer func() {
+			_ = os.RemoveAll(dir)
+			// only removed if nothing else was added to it
+			_ = os.Remove("testdata")
+		}()
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, "events.go"), src, 0o644))
+
+		cmd := exec.Command("go", "build", "-o", os.DevNull, "./"+dir)
+		output, err := cmd.CombinedOutput()
+		assert.Nil(t, err, string(output))
+	})
+
+	t.Run("converts names", func(t *testing.T) {
+		assert.Equal(t, "SongPlayed", identifier("song played"))
+		assert.Equal(t, "LoadTime", identifier("load_time"))
+		assert.Equal(t, "FavoriteGenre", identifier("favoriteGenre"))
+		assert.Equal(t, "X3dView", identifier("3d view"))
+		assert.Equal(t, "X", identifier("$$"))
+		assert.Equal(t, "type_", parameter("Type"))
+		assert.Equal(t, "userPlan", parameter("UserPlan"))
+	})
+
+	t.Run("maps types", func(t *testing.T) {
+		cases := map[string]*amplitude.Schema{
+			"interface{}":            nil,
+			"string":                 {Type: amplitude.SchemaType{"string", "null"}},
+			"int64":                  {Type: amplitude.SchemaType{"integer"}},
+			"[]interface{}":          {Type: amplitude.SchemaType{"array"}},
+			"map[string]interface{}": {Type: amplitude.SchemaType{"object"}},
+		}
+
+		for want, schema := range cases {
+			got, _ := goType(schema)
+			assert.Equal(t, want, got)
+		}
+
+		got, _ := goType(&amplitude.Schema{Type: amplitude.SchemaType{"string", "integer"}})
+		assert.Equal(t, "interface{}", got)
+		got, _ = goType(&amplitude.Schema{Type: amplitude.SchemaType{"custom"}})
+		assert.Equal(t, "interface{}", got)
+	})
+
+	t.Run("rejects conflicting names", func(t *testing.T) {
+		_, err := Generate(&amplitude.TrackingPlan{Events: []*amplitude.PlannedEvent{
+			{Name: "song played"}, {Name: "Song_Played"},
+		}}, "analytics")
+		assert.NotNil(t, err)
+
+		props := &amplitude.Schema{Properties: map[string]*amplitude.Schema{"a_b": {}, "a b": {}}}
+		_, err = Generate(&amplitude.TrackingPlan{Events: []*amplitude.PlannedEvent{
+			{Name: "test", Properties: props},
+		}}, "analytics")
+		assert.NotNil(t, err)
+
+		_, err = Generate(&amplitude.TrackingPlan{Events: []*amplitude.PlannedEvent{
+			{Name: "test", UserProperties: props},
+		}}, "analytics")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("rejects clashing identifiers", func(t *testing.T) {
+		required := func(props ...string) *amplitude.Schema {
+			schema := &amplitude.Schema{Properties: make(map[string]*amplitude.Schema), Required: props}
+			for _, p := range props {
+				schema.Properties[p] = &amplitude.Schema{Type: amplitude.SchemaType{"string"}}
+			}
+			return schema
+		}
+
+		cases := map[string]*amplitude.PlannedEvent{
+			"User field":   {Name: "test", Properties: required("user"), UserProperties: required("plan")},
+			"Event method": {Name: "test", Properties: required("event")},
+			"variable":     {Name: "test", Properties: required("e")},
+			"parameters":   {Name: "test", Properties: required("user_plan"), UserProperties: required("plan")},
+			"declarations": {Name: "test", Properties: &amplitude.Schema{Properties: map[string]*amplitude.Schema{"a": {Enum: []interface{}{"b"}}}}},
+		}
+
+		for name, event := range cases {
+			events := []*amplitude.PlannedEvent{event}
+			if name == "declarations" {
+				events = append(events, &amplitude.PlannedEvent{Name: "test a b"})
+			}
+
+			_, err := Generate(&amplitude.TrackingPlan{Events: events}, "analytics")
+			assert.NotNil(t, err, name)
+		}
+
+		_, err := Generate(&amplitude.TrackingPlan{Events: []*amplitude.PlannedEvent{
+			{Name: "test", Properties: required("user")},
+		}}, "analytics")
+		assert.Nil(t, err)
+	})
+
+	t.Run("bad arguments", func(t *testing.T) {
+		assert.NotNil(t, run("../../amplitude/testdata/tracking-plan.json", "", "events.go"))
+		assert.NotNil(t, run("missing.json", "analytics", "events.go"))
+		assert.NotNil(t, run("../../amplitude/testdata/tracking-plan.json", "bad package", filepath.Join(t.TempDir(), "events.go")))
+	})
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pghq/go-amplitude/amplitude"
+)
+
+const (
+	formatJSON   = "json"
+	formatJSONL  = "jsonl"
+	formatCSV    = "csv"
+	formatExport = "export"
+)
+
+// exportTimeLayout is the layout of event times in files produced by the export API
+const exportTimeLayout = "2006-01-02 15:04:05.999999"
+
+// propertyColumns are the CSV column prefixes of the property maps
+var propertyColumns = []string{"event_properties", "user_properties", "groups", "group_properties"}
+
+// numericFields are the JSON names of the numeric event fields
+var numericFields = func() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeOf(amplitude.Event{})
+	for i := 0; i < t.NumField(); i++ {
+		switch t.Field(i).Type.Kind() {
+		case reflect.Int, reflect.Int64, reflect.Float64:
+			name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+			fields[name] = true
+		}
+	}
+
+	return fields
+}()
+
+// source is a named stream of events
+type source struct {
+	name   string
+	format string
+	r      io.Reader
+
+	// open streams the events when the source is decoded instead of r, e.g. for the entries of archives
+	open func() (io.ReadCloser, error)
+}
+
+// gzipEntry closes a decompressed entry of an archive along with the entry
+type gzipEntry struct {
+	*gzip.Reader
+	entry io.Closer
+}
+
+// Close closes the decompressor and the entry
+func (e gzipEntry) Close() error {
+	_ = e.Reader.Close()
+	return e.entry.Close()
+}
+
+// decodeFunc handles a decoded event, line is its position in the source (from 1)
+type decodeFunc func(line int, event *amplitude.Event) error
+
+// openSources opens the paths as sources, reading stdin if there are none or for "-"
+func openSources(paths []string, format string, stdin io.Reader) ([]source, func(), error) {
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+
+	var closers []io.Closer
+	closeAll := func() {
+		for _, c := range closers {
+			_ = c.Close()
+		}
+	}
+
+	var sources []source
+	for _, path := range paths {
+		if path == "-" {
+			f := format
+			if f == "" {
+				f = formatJSONL
+			}
+
+			sources = append(sources, source{name: "stdin", format: f, r: stdin})
+			continue
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+		closers = append(closers, f)
+
+		opened, err := openFile(path, f, format)
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+
+		sources = append(sources, opened...)
+	}
+
+	return sources, closeAll, nil
+}
+
+// openFile opens a file as sources, decompressing gzip files and expanding zip archives
+func openFile(path string, r io.Reader, format string) ([]source, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gz":
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+
+		return []source{{name: path, format: inferFormat(strings.TrimSuffix(path, filepath.Ext(path)), format), r: gz}}, nil
+	case ".zip":
+		f, ok := r.(*os.File)
+		if !ok {
+			return nil, fmt.Errorf("%s: nested archives are not supported", path)
+		}
+
+		info, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+
+		archive, err := zip.NewReader(f, info.Size())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+
+		var sources []source
+		for _, entry := range archive.File {
+			if entry.FileInfo().IsDir() {
+				continue
+			}
+
+			name := filepath.Join(path, entry.Name)
+			if strings.EqualFold(filepath.Ext(name), ".zip") {
+				return nil, fmt.Errorf("%s: nested archives are not supported", name)
+			}
+
+			sources = append(sources, zipSource(name, entry, format))
+		}
+
+		return sources, nil
+	}
+
+	return []source{{name: path, format: inferFormat(path, format), r: r}}, nil
+}
+
+// zipSource streams an entry of a zip archive when it is decoded, decompressing gzip entries
+func zipSource(name string, entry *zip.File, format string) source {
+	gzipped := strings.EqualFold(filepath.Ext(name), ".gz")
+	inferred := name
+	if gzipped {
+		inferred = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+
+	return source{name: name, format: inferFormat(inferred, format), open: func() (io.ReadCloser, error) {
+		rc, err := entry.Open()
+		if err != nil || !gzipped {
+			return rc, err
+		}
+
+		gz, err := gzip.NewReader(rc)
+		if err != nil {
+			_ = rc.Close()
+			return nil, err
+		}
+
+		return gzipEntry{Reader: gz, entry: rc}, nil
+	}}
+}
+
+// inferFormat gets the format of a file from its extension unless one is given
+func inferFormat(path, format string) string {
+	if format != "" {
+		return format
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return formatJSON
+	case ".csv":
+		return formatCSV
+	}
+
+	return formatJSONL
+}
+
+// decode reads the events of the source in its format
+func decode(src source, fn decodeFunc) error {
+	if src.open != nil {
+		rc, err := src.open()
+		if err != nil {
+			return fmt.Errorf("%s: %v", src.name, err)
+		}
+		defer rc.Close()
+
+		src.r = rc
+	}
+
+	var err error
+	switch src.format {
+	case formatJSON:
+		err = decodeJSON(src.r, fn)
+	case formatJSONL:
+		err = decodeLines(src.r, func(line int, data []byte) error {
+			var event amplitude.Event
+			if err := json.Unmarshal(data, &event); err != nil {
+				return fmt.Errorf("line %d: %v", line, err)
+			}
+
+			return fn(line, &event)
+		})
+	case formatCSV:
+		err = decodeCSV(src.r, fn)
+	case formatExport:
+		err = decodeLines(src.r, func(line int, data []byte) error {
+			event, err := decodeExport(data)
+			if err != nil {
+				return fmt.Errorf("line %d: %v", line, err)
+			}
+
+			return fn(line, event)
+		})
+	default:
+		err = fmt.Errorf("unknown format %s", src.format)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s: %v", src.name, err)
+	}
+
+	return nil
+}
+
+// decodeJSON reads an array of events, an object with an events array or a single event
+func decodeJSON(r io.Reader, fn decodeFunc) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	var events []*amplitude.Event
+	if err := json.Unmarshal(data, &events); err != nil {
+		var body struct {
+			Events []*amplitude.Event `json:"events"`
+		}
+
+		if err := json.Unmarshal(data, &body); err != nil {
+			return err
+		}
+
+		events = body.Events
+		if events == nil {
+			var event amplitude.Event
+			if err := json.Unmarshal(data, &event); err != nil {
+				return err
+			}
+
+			events = append(events, &event)
+		}
+	}
+
+	for i, event := range events {
+		if err := fn(i+1, event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decodeLines reads the non-blank lines of a stream
+func decodeLines(r io.Reader, fn func(line int, data []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+
+	var line int
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		if err := fn(line, data); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// decodeCSV reads events from rows with a header of event field names,
+// property columns are prefixed with the map they belong to (e.g. event_properties.duration)
+func decodeCSV(r io.Reader, fn decodeFunc) error {
+	rows := csv.NewReader(r)
+	header, err := rows.Read()
+	if err != nil {
+		return err
+	}
+
+	for line := 2; ; line++ {
+		row, err := rows.Read()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		fields := make(map[string]interface{})
+		for i, column := range header {
+			if i >= len(row) || row[i] == "" {
+				continue
+			}
+
+			if err := setColumn(fields, strings.TrimSpace(column), row[i]); err != nil {
+				return fmt.Errorf("line %d: %v", line, err)
+			}
+		}
+
+		data, _ := json.Marshal(fields)
+		var event amplitude.Event
+		if err := json.Unmarshal(data, &event); err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+
+		if err := fn(line, &event); err != nil {
+			return err
+		}
+	}
+}
+
+// setColumn sets the value of a CSV column in the event fields
+func setColumn(fields map[string]interface{}, column, value string) error {
+	for _, prefix := range propertyColumns {
+		if !strings.HasPrefix(column, prefix+".") {
+			continue
+		}
+
+		props, _ := fields[prefix].(map[string]interface{})
+		if props == nil {
+			props = make(map[string]interface{})
+			fields[prefix] = props
+		}
+
+		// property values may be JSON (e.g. numbers, booleans, arrays) and are strings otherwise
+		var v interface{}
+		if err := json.Unmarshal([]byte(value), &v); err != nil {
+			v = value
+		}
+
+		props[strings.TrimPrefix(column, prefix+".")] = v
+		return nil
+	}
+
+	if numericFields[column] {
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%s: %v", column, err)
+		}
+
+		fields[column] = n
+		return nil
+	}
+
+	fields[column] = value
+	return nil
+}
+
+// exportEvent is an event as written by the export API
+type exportEvent struct {
+	amplitude.Event
+	InsertId    string `json:"$insert_id"`
+	UUID        string `json:"uuid"`
+	EventTime   string `json:"event_time"`
+	IPAddress   string `json:"ip_address"`
+	Carrier     string `json:"device_carrier"`
+	VersionName string `json:"version_name"`
+}
+
+// decodeExport converts an event of the export API to an event which may be sent again,
+// keeping its insert id so events already ingested are deduplicated
+func decodeExport(data []byte) (*amplitude.Event, error) {
+	var e exportEvent
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+
+	event := e.Event
+	event.InsertId = e.InsertId
+	if event.InsertId == "" {
+		event.InsertId = e.UUID
+	}
+
+	if e.EventTime != "" {
+		t, err := time.Parse(exportTimeLayout, e.EventTime)
+		if err != nil {
+			return nil, fmt.Errorf("event_time: %v", err)
+		}
+
+		event.Time = t.UnixMilli()
+	}
+
+	if e.IPAddress != "" {
+		event.IP = e.IPAddress
+	}
+
+	if e.Carrier != "" {
+		event.Carrier = e.Carrier
+	}
+
+	if event.AppVersion == "" {
+		event.AppVersion = e.VersionName
+	}
+
+	return &event, nil
+}
@@ -0,0 +1,338 @@
+// Copyright 2021 PGHQ. All Rights Reserved.
+//
+// Licensed under the GNU General Public License, Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command amplitude sends, validates and replays Amplitude events from files.
+//
+//	amplitude send [-key key] [-format json|jsonl|csv] [-batch n] [files...]
+//	amplitude validate [-format json|jsonl|csv] [-plan tracking-plan.json] [files...]
+//	amplitude replay [-key key] [-batch n] [files...]
+//	amplitude backfill [-key key] [-checkpoint file] [-concurrency n] [-rate n] [files...]
+//
+// Events are read from stdin when no files are given, gzip files and zip archives
+// (as produced by the export API) are decompressed. The api key defaults to $AMPLITUDE_API_KEY.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+
+	"github.com/pghq/go-amplitude/amplitude"
+)
+
+// DefaultBatchSize is the number of events sent per request
+const DefaultBatchSize = 1000
+
+const usage = `usage: amplitude <command> [flags] [files...]
+
+commands:
+  send      send events from JSON, JSONL or CSV files
+  validate  validate events without sending them
+  replay    send events again from files produced by the export API
+  backfill  import events with bounded concurrency and rate, resuming from a checkpoint
+`
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintln(os.Stderr, "amplitude:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// run runs the command of the arguments
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return flag.ErrHelp
+	}
+
+	switch args[0] {
+	case "send":
+		return send(ctx, args[1:], "", stdin, stdout, stderr)
+	case "replay":
+		return send(ctx, args[1:], formatExport, stdin, stdout, stderr)
+	case "validate":
+		return validate(args[1:], stdin, stdout, stderr)
+	case "backfill":
+		return backfill(ctx, args[1:], stdin, stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return nil
+	}
+
+	fmt.Fprint(stderr, usage)
+	return fmt.Errorf("unknown command %s", args[0])
+}
+
+// send uploads the events of the files in batches, printing the summary of each batch
+func send(ctx context.Context, args []string, format string, stdin io.Reader, stdout, stderr io.Writer) error {
+	name := "send"
+	if format == formatExport {
+		name = "replay"
+	}
+
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	key := flags.String("key", os.Getenv("AMPLITUDE_API_KEY"), "amplitude api key")
+	baseURL := flags.String("url", "", "base url of the amplitude api")
+	batchSize := flags.Int("batch", DefaultBatchSize, "number of events sent per request")
+	asJSON := flags.Bool("json", false, "print the batch summaries as JSON")
+	if format == "" {
+		flags.StringVar(&format, "format", "", "format of the events (json, jsonl or csv), inferred from the file extension by default")
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *batchSize < 1 {
+		return fmt.Errorf("batch size %d must be at least 1", *batchSize)
+	}
+
+	client, err := newClient(*key, *baseURL)
+	if err != nil {
+		return err
+	}
+
+	sources, closeAll, err := openSources(flags.Args(), format, stdin)
+	if err != nil {
+		return err
+	}
+	defer closeAll()
+
+	var batches, ingested, invalid int
+	var batch []*amplitude.Event
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		batches++
+		resp, err := client.Events.Send(ctx, batch...)
+		if err != nil {
+			return fmt.Errorf("batch %d: %v", batches, err)
+		}
+
+		ingested += resp.EventsIngested
+		invalid += len(resp.Invalid)
+		batch = nil
+		for _, verr := range resp.Invalid {
+			fmt.Fprintf(stderr, "batch %d: %v\n", batches, verr)
+		}
+
+		if *asJSON {
+			return json.NewEncoder(stdout).Encode(resp)
+		}
+
+		_, err = fmt.Fprintf(stdout, "batch %d: %s\n", batches, resp)
+		return err
+	}
+
+	for _, src := range sources {
+		err := decode(src, func(_ int, event *amplitude.Event) error {
+			batch = append(batch, event)
+			if len(batch) < *batchSize {
+				return nil
+			}
+
+			return flush()
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+
+	if !*asJSON {
+		fmt.Fprintf(stdout, "%d events ingested in %d batches\n", ingested, batches)
+	}
+
+	if invalid > 0 {
+		return fmt.Errorf("%d invalid events were not sent", invalid)
+	}
+
+	return nil
+}
+
+// validate checks the events of the files without sending them, printing the problems found
+func validate(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	format := flags.String("format", "", "format of the events (json, jsonl, csv or export), inferred from the file extension by default")
+	planPath := flags.String("plan", "", "tracking plan the events are checked against")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var plan *amplitude.TrackingPlan
+	if *planPath != "" {
+		var err error
+		if plan, err = amplitude.OpenTrackingPlan(*planPath); err != nil {
+			return err
+		}
+	}
+
+	sources, closeAll, err := openSources(flags.Args(), *format, stdin)
+	if err != nil {
+		return err
+	}
+	defer closeAll()
+
+	var total, invalid int
+	for _, src := range sources {
+		err := decode(src, func(line int, event *amplitude.Event) error {
+			total++
+			errs := []error{event.Validate()}
+			if plan != nil {
+				errs = append(errs, plan.Check(event))
+			}
+
+			var found bool
+			for _, err := range errs {
+				if err != nil {
+					found = true
+					fmt.Fprintf(stdout, "%s:%d: %v\n", src.name, line, err)
+				}
+			}
+
+			if found {
+				invalid++
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(stdout, "%d events, %d invalid\n", total, invalid)
+	if invalid > 0 {
+		return fmt.Errorf("%d invalid events", invalid)
+	}
+
+	return nil
+}
+
+// backfill imports the events of the files, printing the final report
+func backfill(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	key := flags.String("key", os.Getenv("AMPLITUDE_API_KEY"), "amplitude api key")
+	baseURL := flags.String("url", "", "base url of the amplitude api")
+	format := flags.String("format", "", "format of the events (json, jsonl, csv or export), inferred from the file extension by default")
+	batchSize := flags.Int("batch", DefaultBatchSize, "number of events sent per request")
+	concurrency := flags.Int("concurrency", 1, "number of requests sent at once")
+	rate := flags.Float64("rate", 0, "max number of events sent per second, unlimited if 0")
+	checkpoint := flags.String("checkpoint", "", "file the progress is saved to and resumed from")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	client, err := newClient(*key, *baseURL)
+	if err != nil {
+		return err
+	}
+
+	sources, closeAll, err := openSources(flags.Args(), *format, stdin)
+	if err != nil {
+		return err
+	}
+	defer closeAll()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	report, err := client.NewBackfill(stream(ctx, sources)).
+		BatchSize(*batchSize, 0).
+		Concurrency(*concurrency).
+		Rate(*rate).
+		Checkpoint(*checkpoint).
+		Run(ctx)
+	if report != nil {
+		fmt.Fprintln(stdout, report)
+		for _, err := range report.Errors {
+			fmt.Fprintln(stderr, err)
+		}
+	}
+
+	return err
+}
+
+// newClient creates a client for the api key and base url
+func newClient(key, baseURL string) (*amplitude.Client, error) {
+	if key == "" {
+		return nil, fmt.Errorf("no api key, use -key or set AMPLITUDE_API_KEY")
+	}
+
+	client := amplitude.New(key)
+	if baseURL != "" {
+		u, err := url.Parse(baseURL)
+		if err != nil {
+			return nil, err
+		}
+		client.BaseURL = u
+	}
+
+	return client, nil
+}
+
+// stream reads the events of the sources in order as a backfill source
+func stream(ctx context.Context, sources []source) amplitude.EventSource {
+	events := make(chan *amplitude.Event)
+	var err error
+	go func() {
+		defer close(events)
+		for _, src := range sources {
+			err = decode(src, func(_ int, event *amplitude.Event) error {
+				select {
+				case events <- event:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return amplitude.EventSourceFunc(func() (*amplitude.Event, error) {
+		event, ok := <-events
+		if !ok {
+			if err != nil {
+				return nil, err
+			}
+
+			return nil, io.EOF
+		}
+
+		return event, nil
+	})
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pghq/go-amplitude/amplitude"
+	"github.com/pghq/go-amplitude/amplitude/amplitudetest"
+)
+
+// execute runs the command, returning its output
+func execute(stdin string, args ...string) (string, string, error) {
+	var stdout, stderr bytes.Buffer
+	err := run(context.TODO(), args, strings.NewReader(stdin), &stdout, &stderr)
+	return stdout.String(), stderr.String(), err
+}
+
+func TestSend(t *testing.T) {
+	t.Run("sends files in batches", func(t *testing.T) {
+		s := amplitudetest.NewServer(t)
+		stdout, _, err := execute("", "send", "-key", "test-key", "-url", s.URL, "-batch", "2",
+			"testdata/events.jsonl", "testdata/events.json", "testdata/events.csv")
+		assert.Nil(t, err)
+		assert.Contains(t, stdout, "batch 1: 2 events ingested")
+		assert.Contains(t, stdout, "batch 4: 1 events ingested")
+		assert.Contains(t, stdout, "7 events ingested in 4 batches\n")
+		assert.Len(t, s.Events(), 7)
+
+		csv := s.ExpectEvent("Song Played", amplitudetest.All(
+			amplitudetest.Property("duration", 354),
+			amplitudetest.UserProperty("plan", "premium"),
+		))
+		assert.Equal(t, int64(1633046400000), csv.Time)
+		assert.Equal(t, 1.99, s.ExpectEvent("Signed Up", func(e *amplitude.Event) bool { return e.Price > 0 }).Price)
+	})
+
+	t.Run("sends stdin", func(t *testing.T) {
+		s := amplitudetest.NewServer(t)
+		os.Setenv("AMPLITUDE_API_KEY", "test-key")
+		defer os.Unsetenv("AMPLITUDE_API_KEY")
+
+		stdout, _, err := execute(`[{"event_type": "Signed Up", "user_id": "test-user"}]`, "send", "-url", s.URL, "-format", "json", "-json", "-")
+		assert.Nil(t, err)
+		assert.Contains(t, stdout, `"events_ingested":1`)
+		s.ExpectEvent("Signed Up", amplitudetest.User("test-user"))
+	})
+
+	t.Run("replays exported events", func(t *testing.T) {
+		export, _ := os.ReadFile("testdata/export.json")
+		dir := t.TempDir()
+
+		var gz bytes.Buffer
+		w := gzip.NewWriter(&gz)
+		_, _ = w.Write(export)
+		_ = w.Close()
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, "export.json.gz"), gz.Bytes(), 0o644))
+
+		f, _ := os.Create(filepath.Join(dir, "export.zip"))
+		archive := zip.NewWriter(f)
+		_, _ = archive.Create("123456/")
+		entry, _ := archive.Create("123456/123456_2021-10-01_0#0.json.gz")
+		_, _ = entry.Write(gz.Bytes())
+		_ = archive.Close()
+		_ = f.Close()
+
+		s := amplitudetest.NewServer(t)
+		stdout, _, err := execute("", "replay", "-key", "test-key", "-url", s.URL,
+			filepath.Join(dir, "export.json.gz"), filepath.Join(dir, "export.zip"))
+		assert.Nil(t, err)
+
+		// the archive holds the same events, which keep their insert ids and are deduplicated
+		assert.Contains(t, stdout, "2 events ingested in 1 batches")
+
+		event := s.ExpectEvent("Song Played", amplitudetest.Property("title", "Imagine"))
+		assert.Equal(t, "5f2e7c3a-1", event.InsertId)
+		assert.Equal(t, int64(1633046400123), event.Time)
+		assert.Equal(t, "81.2.69.1", event.IP)
+		assert.Equal(t, "Verizon", event.Carrier)
+		assert.Equal(t, "United States", event.Country)
+		assert.Equal(t, "1.2.3", event.AppVersion)
+		assert.Equal(t, "d4e5f6", s.ExpectEvent("Signed Up", nil).InsertId)
+	})
+
+	t.Run("bad arguments", func(t *testing.T) {
+		s := amplitudetest.NewServer(t)
+		os.Unsetenv("AMPLITUDE_API_KEY")
+
+		_, stderr, err := execute("")
+		assert.Equal(t, flag.ErrHelp, err)
+		assert.Contains(t, stderr, "usage: amplitude")
+
+		stdout, _, err := execute("", "help")
+		assert.Nil(t, err)
+		assert.Contains(t, stdout, "usage: amplitude")
+
+		_, _, err = execute("", "unknown")
+		assert.EqualError(t, err, "unknown command unknown")
+
+		_, _, err = execute("", "send", "-unknown")
+		assert.NotNil(t, err)
+
+		_, _, err = execute("", "send", "testdata/events.jsonl")
+		assert.EqualError(t, err, "no api key, use -key or set AMPLITUDE_API_KEY")
+
+		_, _, err = execute("", "send", "-key", "test-key", "-batch", "0")
+		assert.NotNil(t, err)
+
+		_, _, err = execute("", "send", "-key", "test-key", "-url", ":", "testdata/events.jsonl")
+		assert.NotNil(t, err)
+
+		_, _, err = execute("", "send", "-key", "test-key", "missing.jsonl")
+		assert.NotNil(t, err)
+
+		_, _, err = execute("{", "send", "-key", "test-key", "-url", s.URL)
+		assert.Contains(t, err.Error(), "stdin: line 1: ")
+
+		_, _, err = execute("", "send", "-key", "test-key", "-format", "xml", "testdata/events.json")
+		assert.EqualError(t, err, "testdata/events.json: unknown format xml")
+
+		_, _, err = execute("", "replay", "-key", "test-key", "testdata/events.csv")
+		assert.NotNil(t, err)
+
+		// archives are checked when opened, their entries when they are read
+		dir := t.TempDir()
+		for name, entry := range map[string]string{"nested.zip": "events.zip", "corrupt.zip": "events.json.gz"} {
+			f, _ := os.Create(filepath.Join(dir, name))
+			archive := zip.NewWriter(f)
+			w, _ := archive.Create(entry)
+			_, _ = w.Write([]byte("not gzip"))
+			_ = archive.Close()
+			_ = f.Close()
+		}
+
+		_, _, err = execute("", "replay", "-key", "test-key", "-url", s.URL, filepath.Join(dir, "nested.zip"))
+		assert.Contains(t, err.Error(), "nested archives are not supported")
+
+		_, _, err = execute("", "replay", "-key", "test-key", "-url", s.URL, filepath.Join(dir, "corrupt.zip"))
+		assert.Contains(t, err.Error(), "corrupt.zip/events.json.gz: ")
+		assert.Empty(t, s.Events())
+	})
+
+	t.Run("reports invalid events", func(t *testing.T) {
+		s := amplitudetest.NewServer(t)
+		_, stderr, err := execute("", "send", "-key", "test-key", "-url", s.URL, "testdata/invalid.jsonl")
+		assert.EqualError(t, err, "1 invalid events were not sent")
+		assert.Contains(t, stderr, "batch 1: amplitude: event 1 () is invalid")
+		s.ExpectEvent("Song Played", nil)
+	})
+}
+
+func TestValidate(t *testing.T) {
+	t.Run("reports invalid events", func(t *testing.T) {
+		stdout, _, err := execute("", "validate", "-plan", "../../amplitude/testdata/tracking-plan.json",
+			"testdata/events.jsonl", "testdata/invalid.jsonl")
+		assert.EqualError(t, err, "4 invalid events")
+		assert.Contains(t, stdout, "testdata/events.jsonl:1: amplitude: event Song Played violates the tracking plan: ")
+		assert.Contains(t, stdout, "testdata/invalid.jsonl:1: amplitude: event Song Played violates the tracking plan: ")
+		assert.Contains(t, stdout, "testdata/invalid.jsonl:2: amplitude: event 0 () is invalid: ")
+		assert.Contains(t, stdout, "testdata/events.jsonl:4: amplitude: event Song Played violates the tracking plan: ")
+		assert.Contains(t, stdout, "5 events, 4 invalid\n")
+	})
+
+	t.Run("accepts valid events", func(t *testing.T) {
+		stdout, _, err := execute("", "validate", "testdata/events.json", "testdata/events.csv")
+		assert.Nil(t, err)
+		assert.Equal(t, "4 events, 0 invalid\n", stdout)
+
+		stdout, _, err = execute("", "validate", "-format", "export", "testdata/export.json")
+		assert.Nil(t, err)
+		assert.Equal(t, "2 events, 0 invalid\n", stdout)
+	})
+
+	t.Run("bad arguments", func(t *testing.T) {
+		_, _, err := execute("", "validate", "-unknown")
+		assert.NotNil(t, err)
+
+		_, _, err = execute("", "validate", "-plan", "missing.json")
+		assert.NotNil(t, err)
+
+		_, _, err = execute("", "validate", "missing.json")
+		assert.NotNil(t, err)
+
+		_, _, err = execute("", "validate", "-format", "export", "testdata/events.csv")
+		assert.NotNil(t, err)
+	})
+}
+
+func TestDecode(t *testing.T) {
+	t.Run("decodes csv values", func(t *testing.T) {
+		var events []*amplitude.Event
+		err := decode(source{format: formatCSV, r: strings.NewReader(
+			"event_type,user_id,event_properties.tags,groups.org\nSong Played,12345,\"[\"\"rock\"\"]\",pghq\n",
+		)}, func(_ int, event *amplitude.Event) error {
+			events = append(events, event)
+			return nil
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, "12345", events[0].UserId)
+		assert.Equal(t, []interface{}{"rock"}, events[0].Properties["tags"])
+		assert.Equal(t, "pghq", events[0].Groups["org"])
+	})
+
+	t.Run("rejects bad input", func(t *testing.T) {
+		noop := func(int, *amplitude.Event) error { return nil }
+		bad := []source{
+			{format: formatCSV, r: strings.NewReader("")},
+			{format: formatCSV, r: strings.NewReader("event_type,time\nSong Played,yesterday\n")},
+			{format: formatCSV, r: strings.NewReader("event_type,user_id\n\"Song Played\n")},
+			{format: formatCSV, r: strings.NewReader("event_type,event_properties\nSong Played,1\n")},
+			{format: formatJSON, r: strings.NewReader(`"event"`)},
+			{format: formatJSON, r: strings.NewReader(`{"event_type": 1}`)},
+			{format: formatExport, r: strings.NewReader(`{"event_time": "yesterday"}`)},
+			{format: formatExport, r: strings.NewReader(`{`)},
+		}
+
+		for _, src := range bad {
+			assert.NotNil(t, decode(src, noop), src.format)
+		}
+	})
+
+	t.Run("opens archives", func(t *testing.T) {
+		dir := t.TempDir()
+		_ = os.WriteFile(filepath.Join(dir, "bad.gz"), []byte("not gzip"), 0o644)
+		_ = os.WriteFile(filepath.Join(dir, "bad.zip"), []byte("not zip"), 0o644)
+
+		_, _, err := openSources([]string{filepath.Join(dir, "bad.gz")}, "", nil)
+		assert.NotNil(t, err)
+
+		_, _, err = openSources([]string{filepath.Join(dir, "bad.zip")}, "", nil)
+		assert.NotNil(t, err)
+
+		_, err = openFile("nested.zip", strings.NewReader(""), "")
+		assert.NotNil(t, err)
+	})
+}
+
+func TestBackfill(t *testing.T) {
+	t.Run("imports and resumes", func(t *testing.T) {
+		s := amplitudetest.NewServer(t)
+		checkpoint := filepath.Join(t.TempDir(), "checkpoint.json")
+
+		stdout, stderr, err := execute("", "backfill", "-key", "test-key", "-url", s.URL, "-batch", "2",
+			"-concurrency", "2", "-checkpoint", checkpoint, "testdata/events.jsonl", "testdata/invalid.jsonl")
+		assert.Nil(t, err)
+		assert.Contains(t, stdout, "4 events ingested, 1 rejected, 0 skipped in 2 batches")
+		assert.Contains(t, stderr, "amplitude: event 4 () is invalid")
+		assert.Len(t, s.Events(), 4)
+
+		stdout, _, err = execute("", "backfill", "-key", "test-key", "-url", s.URL, "-checkpoint", checkpoint,
+			"testdata/events.jsonl", "testdata/invalid.jsonl")
+		assert.Nil(t, err)
+		assert.Contains(t, stdout, "0 events ingested, 0 rejected, 5 skipped in 0 batches")
+		assert.Len(t, s.Events(), 4)
+	})
+
+	t.Run("bad arguments", func(t *testing.T) {
+		_, _, err := execute("", "backfill", "-unknown")
+		assert.NotNil(t, err)
+
+		_, _, err = execute("", "backfill", "-key", "", "testdata/events.jsonl")
+		assert.NotNil(t, err)
+
+		_, _, err = execute("", "backfill", "-key", "test-key", "missing.jsonl")
+		assert.NotNil(t, err)
+
+		_, _, err = execute("{", "backfill", "-key", "test-key")
+		assert.Contains(t, err.Error(), "stdin: line 1: ")
+	})
+}